@@ -1,34 +1,70 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
+	"mime"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
+	"path"
 	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 
 	"blaze/internal/engine"
+	"blaze/internal/utils"
 
 	"github.com/fsnotify/fsnotify"
 	"github.com/gorilla/websocket"
 )
 
+const (
+	contentDir  = "content"
+	templateDir = "templates"
+	outputDir   = "public"
+	configPath  = "blaze.config.json"
+	stylesDir   = "blaze-styles"
+)
+
 var (
-	liveReloadClients = make(map[*websocket.Conn]bool)
+	// liveReloadClients maps each connected browser tab to the page path it
+	// is currently viewing.
+	liveReloadClients = make(map[*websocket.Conn]string)
 	clientsMux        sync.Mutex
 	upgrader          = websocket.Upgrader{
-		CheckOrigin: func(r *http.Request) bool { return true },
+		CheckOrigin: checkOrigin,
 	}
+
+	// siteRoutes holds the routes of the last successful build.
+	siteRoutes atomic.Pointer[utils.Routes]
+
+	// pageDigests holds the page digests of the last successful build. Only
+	// build writes it, and the watcher runs one build at a time.
+	pageDigests map[string]string
 )
 
 func main() {
 	buildCmd := flag.NewFlagSet("build", flag.ExitOnError)
 	serveCmd := flag.NewFlagSet("serve", flag.ExitOnError)
 
+	var buildOpts, serveOpts engine.BuildOptions
+	buildCmd.BoolVar(&buildOpts.Drafts, "drafts", false, "Include pages marked draft: true")
+	buildCmd.BoolVar(&buildOpts.Future, "future", false, "Include pages dated in the future")
+
 	servePort := serveCmd.String("port", "3000", "Port to serve on")
+	serveHost := serveCmd.String("host", "localhost", "Host interface to bind to")
+	serveCmd.BoolVar(&serveOpts.Drafts, "drafts", false, "Include pages marked draft: true")
+	serveCmd.BoolVar(&serveOpts.Future, "future", false, "Include pages dated in the future")
 
 	if len(os.Args) < 2 {
 		fmt.Println("Usage: ssg <command> [options]")
@@ -43,12 +79,12 @@ func main() {
 	switch command {
 	case "build":
 		buildCmd.Parse(os.Args[2:])
-		if err := build(); err != nil {
+		if err := build(buildOpts); err != nil {
 			log.Fatal(err)
 		}
 	case "serve":
 		serveCmd.Parse(os.Args[2:])
-		if err := serve(*servePort); err != nil {
+		if err := serve(*serveHost, *servePort, serveOpts); err != nil {
 			log.Fatal(err)
 		}
 	default:
@@ -57,39 +93,83 @@ func main() {
 	}
 }
 
-func build() error {
-	ssg, err := engine.NewSSG("content", "templates", "public", "blaze.config.json")
+func build(opts engine.BuildOptions) error {
+	ssg, err := engine.NewSSG(contentDir, templateDir, outputDir, configPath, opts)
 	if err != nil {
 		return err
 	}
 
-	return ssg.Build()
+	if err := ssg.Build(); err != nil {
+		return err
+	}
+
+	siteRoutes.Store(ssg.Routes())
+	pageDigests = ssg.PageDigests()
+	return nil
 }
 
-func serve(port string) error {
-	if err := build(); err != nil {
+func currentURLStyle() string {
+	if routes := siteRoutes.Load(); routes != nil {
+		return routes.Style()
+	}
+	return utils.URLStyleClean
+}
+
+func serve(host, port string, opts engine.BuildOptions) error {
+	if err := build(opts); err != nil {
 		return err
 	}
 
-	go watchAndRebuild()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go watchAndRebuild(ctx, opts)
 
-	http.HandleFunc("/livereload", liveReloadHandler)
-	http.HandleFunc("/", injectLiveReload)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/livereload", liveReloadHandler)
+	mux.HandleFunc("/", injectLiveReload)
 
-	fmt.Printf("Serving at http://localhost:%s\n", port)
+	addr := net.JoinHostPort(host, port)
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- server.ListenAndServe()
+	}()
+
+	fmt.Printf("Serving at http://%s\n", addr)
 	fmt.Println("Watching for changes...")
 
-	return http.ListenAndServe(":"+port, nil)
+	select {
+	case err := <-serverErr:
+		return err
+	case <-ctx.Done():
+	}
+
+	fmt.Println("\nShutting down...")
+	closeLiveReloadClients()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := server.Shutdown(shutdownCtx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
 }
 
-func watchAndRebuild() {
+func watchAndRebuild(ctx context.Context, opts engine.BuildOptions) {
 	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
 		log.Fatal(err)
 	}
 	defer watcher.Close()
 
-	watchFilesAndDirs := []string{"blaze.config.json", "content", "templates"}
+	watchFilesAndDirs := []string{configPath, contentDir, templateDir}
 	for _, filesAndDirs := range watchFilesAndDirs {
 		err := filepath.Walk(filesAndDirs, func(path string, info os.FileInfo, err error) error {
 			if err != nil {
@@ -105,24 +185,158 @@ func watchAndRebuild() {
 		}
 	}
 
+	// Editors usually emit several events per save, so changes are collected
+	// for a short while and handled as one batch.
+	pending := make(map[string]fsnotify.Op)
+	var debounce <-chan time.Time
+
 	for {
 		select {
+		case <-ctx.Done():
+			return
 		case event := <-watcher.Events:
 			if event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Remove) != 0 {
 				fmt.Printf("Change detected: %s\n", event.Name)
-				if err := build(); err != nil {
-					log.Printf("Build error: %v\n", err)
-				} else {
-					fmt.Println("Rebuild complete!")
-					triggerReload()
-				}
+				pending[event.Name] |= event.Op
+				debounce = time.After(100 * time.Millisecond)
 			}
+		case <-debounce:
+			handleChanges(pending, opts)
+			pending = make(map[string]fsnotify.Op)
+			debounce = nil
 		case err := <-watcher.Errors:
 			log.Printf("Watcher error: %v\n", err)
 		}
 	}
 }
 
+func handleChanges(changes map[string]fsnotify.Op, opts engine.BuildOptions) {
+	if stylesheets, ok := changedStylesheets(changes); ok {
+		for _, stylesheet := range stylesheets {
+			href, err := copyStylesheet(stylesheet)
+			if err != nil {
+				log.Printf("Failed to copy %s: %v\n", stylesheet, err)
+				continue
+			}
+			fmt.Printf("Stylesheet updated: %s\n", href)
+			triggerStyleSwap(href)
+		}
+		return
+	}
+
+	previous := pageDigests
+	if err := build(opts); err != nil {
+		log.Printf("Build error: %v\n", err)
+		return
+	}
+	fmt.Println("Rebuild complete!")
+
+	if onlyNoteEdits(changes) {
+		if pages, ok := changedPages(previous, pageDigests); ok {
+			triggerPageReload(pages)
+			return
+		}
+	}
+	triggerReload()
+}
+
+// changedStylesheets reports whether every change is an edit of an existing
+// stylesheet under the styles directory, in which case the site does not
+// need to be rebuilt.
+func changedStylesheets(changes map[string]fsnotify.Op) ([]string, bool) {
+	stylesPath := filepath.Join(templateDir, stylesDir) + string(filepath.Separator)
+
+	var stylesheets []string
+	for path, op := range changes {
+		if !strings.HasPrefix(path, stylesPath) || filepath.Ext(path) != ".css" {
+			return nil, false
+		}
+		if op&fsnotify.Remove != 0 {
+			return nil, false
+		}
+		stylesheets = append(stylesheets, path)
+	}
+	return stylesheets, len(stylesheets) > 0
+}
+
+func copyStylesheet(path string) (string, error) {
+	relPath, err := filepath.Rel(templateDir, path)
+	if err != nil {
+		return "", err
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	// Mirror the output name given by Pipeline.ProcessTemplates.
+	outputRel := utils.StaticOutputPath(relPath)
+	outputPath := filepath.Join(outputDir, outputRel)
+	if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(outputPath, content, 0644); err != nil {
+		return "", err
+	}
+
+	return "/" + filepath.ToSlash(outputRel), nil
+}
+
+// onlyNoteEdits reports whether every change is an edit of an existing
+// markdown file. Any other change (new or removed files, assets, templates,
+// config) may affect every page.
+func onlyNoteEdits(changes map[string]fsnotify.Op) bool {
+	for path, op := range changes {
+		if op != fsnotify.Write || filepath.Ext(path) != ".md" {
+			return false
+		}
+		relPath, err := filepath.Rel(contentDir, path)
+		if err != nil || strings.HasPrefix(relPath, "..") {
+			return false
+		}
+	}
+	return len(changes) > 0
+}
+
+// changedPages returns the paths of the pages whose output differs between
+// two builds. An edit can change more than its own page: a new title or date
+// changes the explorer of every page, and an embedded note changes the pages
+// embedding it. When pages were added or removed, as by publish or draft,
+// every tab is reloaded instead.
+func changedPages(before, after map[string]string) (map[string]bool, bool) {
+	if before == nil || len(before) != len(after) {
+		return nil, false
+	}
+
+	pages := make(map[string]bool)
+	for output, digest := range after {
+		previous, ok := before[output]
+		if !ok {
+			return nil, false
+		}
+		if previous != digest {
+			pages[pageKey("/"+filepath.ToSlash(output))] = true
+		}
+	}
+	return pages, true
+}
+
+// checkOrigin only accepts websocket upgrades from pages served by this
+// server. Requests without an Origin header do not come from a browser.
+func checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Host, r.Host)
+}
+
 func liveReloadHandler(w http.ResponseWriter, r *http.Request) {
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
@@ -131,7 +345,7 @@ func liveReloadHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	clientsMux.Lock()
-	liveReloadClients[conn] = true
+	liveReloadClients[conn] = normalizePagePath(r.URL.Query().Get("path"))
 	clientsMux.Unlock()
 
 	defer func() {
@@ -150,57 +364,211 @@ func liveReloadHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func triggerReload() {
+	broadcast("reload", func(string) bool { return true })
+}
+
+func triggerPageReload(pages map[string]bool) {
+	broadcast("reload", func(page string) bool { return pages[page] })
+}
+
+func triggerStyleSwap(href string) {
+	broadcast("css:"+href, func(string) bool { return true })
+}
+
+func closeLiveReloadClients() {
 	clientsMux.Lock()
 	defer clientsMux.Unlock()
 
+	message := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+	deadline := time.Now().Add(time.Second)
 	for client := range liveReloadClients {
-		if err := client.WriteMessage(websocket.TextMessage, []byte("reload")); err != nil {
-			log.Printf("Error sending reload: %v\n", err)
-		}
+		_ = client.WriteControl(websocket.CloseMessage, message, deadline)
+		client.Close()
 	}
 }
-func injectLiveReload(w http.ResponseWriter, r *http.Request) {
-	path := r.URL.Path
-
-	if !strings.Contains(filepath.Base(path), ".") {
-		if path == "/" {
-			path = "/index.html"
-		} else {
-			tryHTML := filepath.Join("public", path+".html")
-
-			if _, err := os.Stat(tryHTML); err == nil {
-				path = path + ".html"
-			} else {
-				path = filepath.Join(path, "index.html")
-			}
+
+func broadcast(message string, match func(page string) bool) {
+	clientsMux.Lock()
+	defer clientsMux.Unlock()
+
+	for client, page := range liveReloadClients {
+		if !match(page) {
+			continue
+		}
+		if err := client.WriteMessage(websocket.TextMessage, []byte(message)); err != nil {
+			log.Printf("Error sending %q: %v\n", message, err)
 		}
 	}
+}
 
-	filePath := filepath.Join("public", path)
+// pageKey maps the different URLs a page can be requested by (/a/b, /a/b/,
+// /a/b.html, /a/b/index.html) to the same key, whatever the URL style.
+func pageKey(urlPath string) string {
+	urlPath = strings.TrimSuffix(urlPath, ".html")
+	urlPath = strings.TrimSuffix(urlPath, "/index")
+	if len(urlPath) > 1 {
+		urlPath = strings.TrimSuffix(urlPath, "/")
+	}
+	if urlPath == "" {
+		urlPath = "/"
+	}
+	return urlPath
+}
 
-	if strings.HasSuffix(filePath, ".html") {
-		content, err := os.ReadFile(filePath)
-		if err != nil {
-			http.NotFound(w, r)
-			return
-		}
+// normalizePagePath returns the key of the page a live reload client reports,
+// which is sent percent-encoded.
+func normalizePagePath(pagePath string) string {
+	if unescaped, err := url.PathUnescape(pagePath); err == nil {
+		pagePath = unescaped
+	}
+	return pageKey(pagePath)
+}
 
-		htmlStr := string(content)
-		liveReloadScript := `
+const liveReloadScript = `
 <script>
 (function() {
-	const ws = new WebSocket('ws://' + window.location.host + '/livereload');
-	ws.onmessage = function() { window.location.reload(); };
+	const ws = new WebSocket('ws://' + window.location.host + '/livereload?path=' + encodeURIComponent(window.location.pathname));
+	ws.onmessage = function(event) {
+		if (!event.data.startsWith('css:')) {
+			window.location.reload();
+			return;
+		}
+		const href = event.data.slice(4);
+		document.querySelectorAll('link[rel="stylesheet"]').forEach(function(link) {
+			if (new URL(link.href, window.location.href).pathname === href) {
+				link.href = href + '?v=' + Date.now();
+			}
+		});
+	};
 })();
 </script>
 </body>`
 
-		htmlStr = strings.Replace(htmlStr, "</body>", liveReloadScript, 1)
+func injectLiveReload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Cleaning a rooted path removes every ".." element, so the result is
+	// always relative to the output directory.
+	urlPath := path.Clean("/" + r.URL.Path)
 
-		w.Header().Set("Content-Type", "text/html")
-		w.Write([]byte(htmlStr))
+	name, file, info, err := resolveOutputFile(strings.TrimPrefix(urlPath, "/"))
+	if err != nil {
+		serveNotFound(w, r)
 		return
 	}
+	defer file.Close()
 
-	http.FileServer(http.Dir("public")).ServeHTTP(w, r)
+	// Redirect every other form of a page URL to the one used in links.
+	if target, ok := outputURL(name); ok && target != r.URL.Path {
+		target = utils.EscapeURLPath(target)
+		if r.URL.RawQuery != "" {
+			target += "?" + r.URL.RawQuery
+		}
+		http.Redirect(w, r, target, http.StatusMovedPermanently)
+		return
+	}
+
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	if path.Ext(name) == ".html" {
+		serveHTML(w, r, file, http.StatusOK)
+		return
+	}
+
+	if contentType := mime.TypeByExtension(path.Ext(name)); contentType != "" {
+		w.Header().Set("Content-Type", contentType)
+	}
+	http.ServeContent(w, r, name, info.ModTime(), file)
+}
+
+// resolveOutputFile finds the file generated for a URL path in any of the
+// URL styles: /a/b is served from a/b.html or a/b/index.html, and /a/b.html
+// from a/b.html or a/b/index.html.
+func resolveOutputFile(name string) (string, *os.File, os.FileInfo, error) {
+	var candidates []string
+	switch ext := path.Ext(name); {
+	case name == "":
+		candidates = []string{"index.html"}
+	case ext == "":
+		candidates = []string{name + ".html", path.Join(name, "index.html")}
+	case ext == ".html":
+		candidates = []string{name, path.Join(strings.TrimSuffix(name, ext), "index.html")}
+	default:
+		candidates = []string{name}
+	}
+
+	var err error
+	for _, candidate := range candidates {
+		var file *os.File
+		var info os.FileInfo
+		if file, info, err = openOutputFile(candidate); err == nil {
+			return candidate, file, info, nil
+		}
+	}
+	return "", nil, nil, err
+}
+
+// outputURL returns the URL links use for a generated page, if name is one.
+func outputURL(name string) (string, bool) {
+	routes := siteRoutes.Load()
+	if routes == nil {
+		return "", false
+	}
+	route, ok := routes.ByOutput(name)
+	if !ok || !route.Page {
+		return "", false
+	}
+	return route.URL, true
+}
+
+// openOutputFile opens name, a slash-separated path relative to the output
+// directory. Lookups cannot escape the output directory, even via symlinks.
+func openOutputFile(name string) (*os.File, os.FileInfo, error) {
+	file, err := os.OpenInRoot(outputDir, filepath.FromSlash(name))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	info, err := file.Stat()
+	if err == nil && info.IsDir() {
+		err = fmt.Errorf("%s is a directory", name)
+	}
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+
+	return file, info, nil
+}
+
+func serveNotFound(w http.ResponseWriter, r *http.Request) {
+	file, _, err := openOutputFile("404.html")
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer file.Close()
+
+	serveHTML(w, r, file, http.StatusNotFound)
+}
+
+func serveHTML(w http.ResponseWriter, r *http.Request, file *os.File, status int) {
+	content, err := io.ReadAll(file)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	htmlStr := strings.Replace(string(content), "</body>", liveReloadScript, 1)
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if r.Method != http.MethodHead {
+		io.WriteString(w, htmlStr)
+	}
 }
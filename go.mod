@@ -8,11 +8,12 @@ require (
 	github.com/gorilla/websocket v1.5.3
 	github.com/yuin/goldmark v1.7.13
 	github.com/yuin/goldmark-meta v1.1.0
+	golang.org/x/net v0.47.0
 	golang.org/x/sync v0.18.0
+	gopkg.in/yaml.v2 v2.3.0
 )
 
 require (
 	github.com/dlclark/regexp2 v1.11.5 // indirect
-	golang.org/x/sys v0.13.0 // indirect
-	gopkg.in/yaml.v2 v2.3.0 // indirect
+	golang.org/x/sys v0.38.0 // indirect
 )
@@ -0,0 +1,77 @@
+// Package assets embeds the third-party libraries pages load, so sites built
+// with the local asset mode work without reaching a CDN.
+package assets
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// thirdParty names every file pages reference, so a checkout without them,
+// as fetched by make vendor-assets, fails to compile instead of producing a
+// binary whose local asset mode cannot work.
+//
+//go:embed third_party/katex/katex.min.css third_party/katex/katex.min.js
+//go:embed third_party/katex/contrib/auto-render.min.js third_party/katex/fonts
+//go:embed third_party/mermaid/mermaid.min.js
+var thirdParty embed.FS
+
+// Asset modes, selected by the assetMode config option.
+const (
+	// ModeCDN loads libraries from jsDelivr.
+	ModeCDN = "cdn"
+	// ModeLocal copies the embedded libraries into the site.
+	ModeLocal = "local"
+)
+
+// OutputDir is where libraries are copied in the output directory.
+const OutputDir = "blaze-vendor"
+
+// Library is a third-party library pages load on demand. Its files live in
+// third_party/<Name> and mirror the dist folder of its npm package.
+type Library struct {
+	Name    string
+	Version string
+}
+
+// Keep the versions in sync with the vendor-assets target of the Makefile.
+var (
+	Katex   = Library{Name: "katex", Version: "0.16.25"}
+	Mermaid = Library{Name: "mermaid", Version: "11.12.2"}
+)
+
+// URL returns the base URL the library's files are loaded from in mode.
+func (l Library) URL(mode string) string {
+	if mode == ModeLocal {
+		return "/" + OutputDir + "/" + l.Name
+	}
+	return fmt.Sprintf("https://cdn.jsdelivr.net/npm/%s@%s/dist", l.Name, l.Version)
+}
+
+// Copy writes the embedded files of the library to outputDir.
+func (l Library) Copy(outputDir string) error {
+	root := path.Join("third_party", l.Name)
+	dest := filepath.Join(outputDir, OutputDir, l.Name)
+	return fs.WalkDir(thirdParty, root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		target := filepath.Join(dest, filepath.FromSlash(strings.TrimPrefix(p, root)))
+
+		if d.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+
+		data, err := thirdParty.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(target, data, 0644)
+	})
+}
@@ -0,0 +1,68 @@
+// Package canvas renders JSON Canvas files, the .canvas boards of Obsidian,
+// as static HTML.
+package canvas
+
+import (
+	"encoding/json"
+	"math"
+)
+
+// Canvas is a board of nodes joined by edges.
+type Canvas struct {
+	Nodes []Node `json:"nodes"`
+	Edges []Edge `json:"edges"`
+}
+
+// Node is a card of a canvas. Its Type is text, file, link or group, and
+// decides which of the fields below it are set.
+type Node struct {
+	ID     string  `json:"id"`
+	Type   string  `json:"type"`
+	X      float64 `json:"x"`
+	Y      float64 `json:"y"`
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+	Color  string  `json:"color"`
+
+	Text    string `json:"text"`
+	File    string `json:"file"`
+	Subpath string `json:"subpath"`
+	URL     string `json:"url"`
+	Label   string `json:"label"`
+}
+
+// Edge is a line from one node to another. Sides are top, right, bottom or
+// left, and ends are none or arrow.
+type Edge struct {
+	ID       string `json:"id"`
+	FromNode string `json:"fromNode"`
+	FromSide string `json:"fromSide"`
+	FromEnd  string `json:"fromEnd"`
+	ToNode   string `json:"toNode"`
+	ToSide   string `json:"toSide"`
+	ToEnd    string `json:"toEnd"`
+	Color    string `json:"color"`
+	Label    string `json:"label"`
+}
+
+// Parse reads a .canvas file.
+func Parse(content []byte) (*Canvas, error) {
+	var c Canvas
+	if err := json.Unmarshal(content, &c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// bounds returns the box around every node.
+func (c *Canvas) bounds() (x1, y1, x2, y2 float64) {
+	if len(c.Nodes) == 0 {
+		return 0, 0, 0, 0
+	}
+	x1, y1, x2, y2 = math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)
+	for _, n := range c.Nodes {
+		x1, y1 = math.Min(x1, n.X), math.Min(y1, n.Y)
+		x2, y2 = math.Max(x2, n.X+n.Width), math.Max(y2, n.Y+n.Height)
+	}
+	return x1, y1, x2, y2
+}
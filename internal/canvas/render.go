@@ -0,0 +1,240 @@
+package canvas
+
+import (
+	"fmt"
+	"html"
+	"math"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// padding is the margin around the nodes, in pixels.
+const padding = 40
+
+// reHexColor matches the custom colors of nodes and edges. The numbered
+// presets are styled by the site's stylesheet.
+var reHexColor = regexp.MustCompile(`^#[0-9a-fA-F]{3,8}$`)
+
+// Resolver renders what the nodes of a canvas point to.
+type Resolver interface {
+	// Markdown renders the text of a text node.
+	Markdown(text string) string
+	// File returns the URL of the file of a file node and, when the file
+	// is a note that can be shown in the canvas, the HTML of its content.
+	// ok is false when the file is not part of the site.
+	File(file, subpath string) (url, content string, ok bool)
+}
+
+// Render returns the canvas as positioned HTML cards, with the edges drawn
+// in an SVG layer below them. The board keeps the size of the canvas and
+// scrolls inside its container.
+func Render(c *Canvas, r Resolver) string {
+	x1, y1, x2, y2 := c.bounds()
+	originX, originY := x1-padding, y1-padding
+	width, height := x2-x1+2*padding, y2-y1+2*padding
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<div class="canvas"><div class="canvas-board" style="width:%spx;height:%spx">`, num(width), num(height))
+
+	// Groups go first so the cards inside them are drawn over them.
+	for _, n := range c.Nodes {
+		if n.Type == "group" {
+			writeNode(&b, n, originX, originY, r)
+		}
+	}
+
+	nodes := make(map[string]Node, len(c.Nodes))
+	for _, n := range c.Nodes {
+		nodes[n.ID] = n
+	}
+	var labels strings.Builder
+	fmt.Fprintf(&b, `<svg class="canvas-edges" width="%s" height="%s" viewBox="%s %s %s %s" aria-hidden="true">`,
+		num(width), num(height), num(originX), num(originY), num(width), num(height))
+	for _, e := range c.Edges {
+		writeEdge(&b, &labels, e, nodes, originX, originY)
+	}
+	b.WriteString("</svg>")
+	b.WriteString(labels.String())
+
+	for _, n := range c.Nodes {
+		if n.Type != "group" {
+			writeNode(&b, n, originX, originY, r)
+		}
+	}
+
+	b.WriteString("</div></div>")
+	return b.String()
+}
+
+func writeNode(b *strings.Builder, n Node, originX, originY float64, r Resolver) {
+	class, style := colorAttrs(n.Color)
+	fmt.Fprintf(b, `<div class="canvas-node canvas-node-%s%s" style="left:%spx;top:%spx;width:%spx;height:%spx%s">`,
+		html.EscapeString(n.Type), class, num(n.X-originX), num(n.Y-originY), num(n.Width), num(n.Height), style)
+
+	switch n.Type {
+	case "text":
+		b.WriteString(`<div class="canvas-node-content">` + r.Markdown(n.Text) + `</div>`)
+	case "file":
+		writeFile(b, n, r)
+	case "link":
+		if isWebURL(n.URL) {
+			fmt.Fprintf(b, `<a class="external" href="%s" target="_blank" rel="noopener noreferrer">%s</a>`,
+				html.EscapeString(n.URL), html.EscapeString(n.URL))
+		} else {
+			b.WriteString(html.EscapeString(n.URL))
+		}
+	case "group":
+		if n.Label != "" {
+			b.WriteString(`<span class="canvas-group-label">` + html.EscapeString(n.Label) + `</span>`)
+		}
+	}
+
+	b.WriteString("</div>")
+}
+
+// writeFile shows an image, or the title and content of a note linked to
+// its page. Files left out of the site are only named.
+func writeFile(b *strings.Builder, n Node, r Resolver) {
+	url, content, ok := r.File(n.File, n.Subpath)
+	name := path.Base(n.File)
+	if !ok {
+		b.WriteString(`<span class="canvas-file-missing">` + html.EscapeString(name) + `</span>`)
+		return
+	}
+
+	if isImage(n.File) {
+		fmt.Fprintf(b, `<img src="%s" alt="%s" loading="lazy" decoding="async">`, html.EscapeString(url), html.EscapeString(name))
+		return
+	}
+
+	title := strings.TrimSuffix(strings.TrimSuffix(name, path.Ext(name)), ".excalidraw")
+	fmt.Fprintf(b, `<a class="canvas-file-title internal" href="%s">%s</a>`, html.EscapeString(url), html.EscapeString(title))
+	if content != "" {
+		b.WriteString(`<div class="canvas-node-content">` + content + `</div>`)
+	}
+}
+
+// writeEdge draws an edge as a curve leaving and entering its nodes square
+// to their sides. Its label goes to labels, as HTML over the SVG layer.
+func writeEdge(b, labels *strings.Builder, e Edge, nodes map[string]Node, originX, originY float64) {
+	from, ok := nodes[e.FromNode]
+	if !ok {
+		return
+	}
+	to, ok := nodes[e.ToNode]
+	if !ok {
+		return
+	}
+
+	fromSide, toSide := e.FromSide, e.ToSide
+	if fromSide == "" {
+		fromSide = facing(from, to)
+	}
+	if toSide == "" {
+		toSide = facing(to, from)
+	}
+
+	p1, d1 := anchor(from, fromSide)
+	p2, d2 := anchor(to, toSide)
+	reach := math.Max(40, math.Min(150, math.Hypot(p2[0]-p1[0], p2[1]-p1[1])/2))
+	c1 := [2]float64{p1[0] + d1[0]*reach, p1[1] + d1[1]*reach}
+	c2 := [2]float64{p2[0] + d2[0]*reach, p2[1] + d2[1]*reach}
+
+	class, style := colorAttrs(e.Color)
+	if style != "" {
+		style = ` style="` + strings.TrimPrefix(style, ";") + `"`
+	}
+	fmt.Fprintf(b, `<g class="canvas-edge%s"%s><path d="M%s %s C%s %s, %s %s, %s %s"/>`, class, style,
+		num(p1[0]), num(p1[1]), num(c1[0]), num(c1[1]), num(c2[0]), num(c2[1]), num(p2[0]), num(p2[1]))
+
+	// An edge ends in an arrow unless it says otherwise; it starts without.
+	if e.ToEnd != "none" {
+		writeArrow(b, p2, d2)
+	}
+	if e.FromEnd == "arrow" {
+		writeArrow(b, p1, d1)
+	}
+	b.WriteString("</g>")
+
+	if e.Label != "" {
+		x := (p1[0]+3*c1[0]+3*c2[0]+p2[0])/8 - originX
+		y := (p1[1]+3*c1[1]+3*c2[1]+p2[1])/8 - originY
+		fmt.Fprintf(labels, `<span class="canvas-edge-label" style="left:%spx;top:%spx">%s</span>`,
+			num(x), num(y), html.EscapeString(e.Label))
+	}
+}
+
+// writeArrow draws an arrowhead at tip, pointing against the direction the
+// edge leaves the side it ends on.
+func writeArrow(b *strings.Builder, tip, direction [2]float64) {
+	const length, spread = 14, 6
+	baseX, baseY := tip[0]+direction[0]*length, tip[1]+direction[1]*length
+	fmt.Fprintf(b, `<polygon points="%s,%s %s,%s %s,%s"/>`,
+		num(tip[0]), num(tip[1]),
+		num(baseX-direction[1]*spread), num(baseY+direction[0]*spread),
+		num(baseX+direction[1]*spread), num(baseY-direction[0]*spread))
+}
+
+// anchor returns the middle of a side of a node and the direction that
+// points out of it.
+func anchor(n Node, side string) (point, direction [2]float64) {
+	switch side {
+	case "top":
+		return [2]float64{n.X + n.Width/2, n.Y}, [2]float64{0, -1}
+	case "bottom":
+		return [2]float64{n.X + n.Width/2, n.Y + n.Height}, [2]float64{0, 1}
+	case "left":
+		return [2]float64{n.X, n.Y + n.Height/2}, [2]float64{-1, 0}
+	default:
+		return [2]float64{n.X + n.Width, n.Y + n.Height/2}, [2]float64{1, 0}
+	}
+}
+
+// facing returns the side of from that faces to, for edges that do not
+// say which side they leave from.
+func facing(from, to Node) string {
+	dx := (to.X + to.Width/2) - (from.X + from.Width/2)
+	dy := (to.Y + to.Height/2) - (from.Y + from.Height/2)
+	switch {
+	case math.Abs(dx) >= math.Abs(dy) && dx >= 0:
+		return "right"
+	case math.Abs(dx) >= math.Abs(dy):
+		return "left"
+	case dy >= 0:
+		return "bottom"
+	default:
+		return "top"
+	}
+}
+
+// colorAttrs returns the class of a preset color, 1 to 6, or the style
+// that sets a custom one.
+func colorAttrs(color string) (class, style string) {
+	switch {
+	case len(color) == 1 && color >= "1" && color <= "6":
+		return " canvas-color-" + color, ""
+	case reHexColor.MatchString(color):
+		return "", ";--canvas-color:" + color
+	}
+	return "", ""
+}
+
+func isImage(file string) bool {
+	switch strings.ToLower(path.Ext(file)) {
+	case ".apng", ".avif", ".bmp", ".gif", ".jpg", ".jpeg", ".png", ".svg", ".webp":
+		return true
+	}
+	return false
+}
+
+func isWebURL(url string) bool {
+	lower := strings.ToLower(url)
+	return strings.HasPrefix(lower, "https://") || strings.HasPrefix(lower, "http://")
+}
+
+// num formats a coordinate, rounded to hundredths.
+func num(v float64) string {
+	return strconv.FormatFloat(math.Round(v*100)/100, 'f', -1, 64)
+}
@@ -4,6 +4,7 @@ import (
 	"html/template"
 
 	"blaze/internal/config"
+	"blaze/internal/utils"
 )
 
 type Component interface {
@@ -12,12 +13,13 @@ type Component interface {
 
 type ComponentFactory struct {
 	config *config.Config
+	routes *utils.Routes
 }
 
-func NewComponentFactory(cfg *config.Config) *ComponentFactory {
-	return &ComponentFactory{config: cfg}
+func NewComponentFactory(cfg *config.Config, routes *utils.Routes) *ComponentFactory {
+	return &ComponentFactory{config: cfg, routes: routes}
 }
 
 func (f *ComponentFactory) CreateExplorer(root string) Component {
-	return NewExplorer(f.config, root)
+	return NewExplorer(f.config, f.routes, root)
 }
@@ -14,19 +14,26 @@ import (
 )
 
 type Explorer struct {
-	config *config.Config
-	root   string
+	config  *config.Config
+	routes  *utils.Routes
+	folders *markdown.FolderDefaults
+	root    string
 }
 
-func NewExplorer(cfg *config.Config, root string) *Explorer {
+func NewExplorer(cfg *config.Config, routes *utils.Routes, root string) *Explorer {
 	return &Explorer{
-		config: cfg,
-		root:   root,
+		config:  cfg,
+		routes:  routes,
+		folders: markdown.NewFolderDefaults(root),
+		root:    root,
 	}
 }
 
 func (e *Explorer) shouldIgnore(name string) bool {
 	baseName := filepath.Base(name)
+	if baseName == markdown.FolderDefaultsFile {
+		return true
+	}
 
 	for _, pattern := range e.config.IgnorePatterns {
 		if name == pattern || baseName == pattern {
@@ -45,7 +52,15 @@ func (e *Explorer) getMetadata(filePath string) (map[string]string, error) {
 	if err != nil {
 		return nil, err
 	}
-	metadata, _ := markdown.ExtractFrontmatter(string(content))
+	metadata := markdown.PageFrontmatter(filePath, content)
+
+	relPath, err := filepath.Rel(e.root, filePath)
+	if err != nil {
+		return nil, err
+	}
+	if err := e.folders.Apply(relPath, metadata); err != nil {
+		return nil, err
+	}
 	return metadata, nil
 }
 
@@ -88,33 +103,33 @@ func (e *Explorer) generateTree(dir string) (template.HTML, error) {
 				subHtml,
 			)
 		} else {
-			metadata, err := e.getMetadata(path)
-			if err != nil {
+			relPath := strings.TrimPrefix(path, e.root+"/")
+			route, ok := e.routes.Get(relPath)
+			if !ok || !route.Page {
+				// Not a page of the site, e.g. an image, a skipped page
+				// or a file matched by an ignore pattern.
 				continue
 			}
 
-			if e.config.PublishMode == "explicit" && metadata["publish"] != "true" {
+			metadata, err := e.getMetadata(path)
+			if err != nil {
 				continue
 			}
 
-			relPath := strings.TrimPrefix(path, e.root+"/")
-			relPath = strings.TrimSuffix(relPath, ".md")
-			slugPath := utils.SlugifyPath(relPath)
-
-			if slugPath == "index" {
-				slugPath = ""
-			} else if strings.HasSuffix(slugPath, "/index") {
-				slugPath = strings.TrimSuffix(slugPath, "/index")
-			}
-
 			title := metadata["title"]
 			if title == "" {
-				title = strings.TrimSuffix(entry.Name(), ".md")
+				title = pageName(entry.Name())
 			}
-			html += fmt.Sprintf(`<li><a href="/%s">%s</a></li>`, slugPath, title)
+			html += fmt.Sprintf(`<li><a href="%s">%s</a></li>`, utils.EscapeURLPath(route.URL), title)
 		}
 	}
 
 	html += "</ul>"
 	return template.HTML(html), nil
 }
+
+// pageName returns the name of a page without the extension of its file.
+func pageName(name string) string {
+	name = strings.TrimSuffix(name, filepath.Ext(name))
+	return strings.TrimSuffix(name, ".excalidraw")
+}
@@ -2,9 +2,30 @@ package config
 
 import (
 	"encoding/json"
+	"fmt"
 	"os"
+	"strings"
+	"time"
+
+	"blaze/internal/assets"
+	"blaze/internal/markdown/extensions"
+	"blaze/internal/utils"
+
+	"github.com/alecthomas/chroma/v2/styles"
 )
 
+// EmbedProvider is a site whose links are embedded as players, in addition
+// to the built-in YouTube, Vimeo and Loom.
+type EmbedProvider struct {
+	Name string `json:"name"`
+	// Schemes are the links of the site, with * for any text, such as
+	// "https://example.com/videos/*".
+	Schemes []string `json:"schemes"`
+	// EmbedURL is the player address, with {url} for the escaped link and
+	// {1}, {2}… for the text matched by each * of the scheme.
+	EmbedURL string `json:"embedURL"`
+}
+
 type Config struct {
 	PageTitle       string   `json:"pageTitle"`
 	PageTitleSuffix string   `json:"pageTitleSuffix"`
@@ -12,6 +33,28 @@ type Config struct {
 	BaseURL         string   `json:"baseURL"`
 	IgnorePatterns  []string `json:"ignorePatterns"`
 	PublishMode     string   `json:"publishMode"`
+	URLStyle        string   `json:"urlStyle"`
+	SlugCollisions  string   `json:"slugCollisions"`
+	SlugMode        string   `json:"slugMode"`
+	RawHTML         string   `json:"rawHTML"`
+	AssetMode       string   `json:"assetMode"`
+	MathRendering   string   `json:"mathRendering"`
+	SyntaxLight     string   `json:"syntaxLight"`
+	SyntaxDark      string   `json:"syntaxDark"`
+
+	EmbedProviders []EmbedProvider `json:"embedProviders"`
+
+	ImageWidths  []int  `json:"imageWidths"`
+	ImageQuality int    `json:"imageQuality"`
+	ImageSizes   string `json:"imageSizes"`
+
+	ImageCaptions string `json:"imageCaptions"`
+	ImageLightbox bool   `json:"imageLightbox"`
+
+	// Set per build rather than in the config file.
+	Drafts    bool      `json:"-"`
+	Future    bool      `json:"-"`
+	BuildTime time.Time `json:"-"`
 }
 
 func Load(path string) (*Config, error) {
@@ -25,5 +68,108 @@ func Load(path string) (*Config, error) {
 		return nil, err
 	}
 
+	switch cfg.URLStyle {
+	case "":
+		cfg.URLStyle = utils.URLStyleClean
+	case utils.URLStyleClean, utils.URLStylePretty, utils.URLStyleHTML:
+	default:
+		return nil, fmt.Errorf("unknown urlStyle %q", cfg.URLStyle)
+	}
+
+	switch cfg.SlugCollisions {
+	case "":
+		cfg.SlugCollisions = "rename"
+	case "rename", "error":
+	default:
+		return nil, fmt.Errorf("unknown slugCollisions %q", cfg.SlugCollisions)
+	}
+
+	switch cfg.SlugMode {
+	case "":
+		cfg.SlugMode = utils.SlugModeASCII
+	case utils.SlugModeASCII, utils.SlugModeUnicode, utils.SlugModeTransliterate:
+	default:
+		return nil, fmt.Errorf("unknown slugMode %q", cfg.SlugMode)
+	}
+
+	switch cfg.RawHTML {
+	case "":
+		cfg.RawHTML = extensions.RawHTMLAllow
+	case extensions.RawHTMLAllow, extensions.RawHTMLStrip, extensions.RawHTMLSanitize:
+	default:
+		return nil, fmt.Errorf("unknown rawHTML %q", cfg.RawHTML)
+	}
+
+	switch cfg.AssetMode {
+	case "":
+		cfg.AssetMode = assets.ModeCDN
+	case assets.ModeCDN, assets.ModeLocal:
+	default:
+		return nil, fmt.Errorf("unknown assetMode %q", cfg.AssetMode)
+	}
+
+	switch cfg.MathRendering {
+	case "":
+		cfg.MathRendering = extensions.MathClient
+	case extensions.MathClient, extensions.MathML:
+	default:
+		return nil, fmt.Errorf("unknown mathRendering %q", cfg.MathRendering)
+	}
+
+	if cfg.SyntaxLight == "" {
+		cfg.SyntaxLight = "gruvbox-light"
+	}
+	if _, ok := styles.Registry[cfg.SyntaxLight]; !ok {
+		return nil, fmt.Errorf("unknown syntaxLight style %q", cfg.SyntaxLight)
+	}
+
+	if cfg.SyntaxDark == "" {
+		cfg.SyntaxDark = "xcode-dark"
+	}
+	if _, ok := styles.Registry[cfg.SyntaxDark]; !ok {
+		return nil, fmt.Errorf("unknown syntaxDark style %q", cfg.SyntaxDark)
+	}
+
+	// An empty list turns resizing off; a missing one uses the defaults.
+	if cfg.ImageWidths == nil {
+		cfg.ImageWidths = []int{480, 960, 1600}
+	}
+	for _, width := range cfg.ImageWidths {
+		if width <= 0 {
+			return nil, fmt.Errorf("invalid imageWidths %d", width)
+		}
+	}
+
+	if cfg.ImageQuality == 0 {
+		cfg.ImageQuality = 80
+	}
+	if cfg.ImageQuality < 1 || cfg.ImageQuality > 100 {
+		return nil, fmt.Errorf("imageQuality %d is not between 1 and 100", cfg.ImageQuality)
+	}
+
+	if cfg.ImageSizes == "" {
+		cfg.ImageSizes = "(max-width: 720px) 100vw, 720px"
+	}
+
+	switch cfg.ImageCaptions {
+	case "":
+		cfg.ImageCaptions = "alt"
+	case "alt", "title", "none":
+	default:
+		return nil, fmt.Errorf("unknown imageCaptions %q", cfg.ImageCaptions)
+	}
+
+	for i, p := range cfg.EmbedProviders {
+		if p.Name == "" {
+			return nil, fmt.Errorf("embedProviders[%d]: missing name", i)
+		}
+		if len(p.Schemes) == 0 {
+			return nil, fmt.Errorf("embed provider %q: missing schemes", p.Name)
+		}
+		if !strings.HasPrefix(p.EmbedURL, "https://") && !strings.HasPrefix(p.EmbedURL, "http://") {
+			return nil, fmt.Errorf("embed provider %q: embedURL must be an http or https URL", p.Name)
+		}
+	}
+
 	return &cfg, nil
 }
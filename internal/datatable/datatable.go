@@ -0,0 +1,232 @@
+// Package datatable renders CSV and TSV data as HTML tables, in the markup
+// of Markdown tables so they share their styles.
+package datatable
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"html"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Table is the data of a CSV or TSV file.
+type Table struct {
+	Header []string
+	Rows   [][]string
+}
+
+// Parse reads CSV data, or TSV when comma is a tab. The first record is the
+// header. Records may have different numbers of fields, and CSV quotes are
+// lenient, since the files are often written by hand.
+func Parse(content []byte, comma rune) (*Table, error) {
+	content = bytes.TrimPrefix(content, []byte("\ufeff"))
+
+	var records [][]string
+	if comma == '\t' {
+		// TSV has no quoting: tabs and newlines cannot be in values.
+		for _, line := range strings.Split(strings.TrimRight(string(content), "\r\n"), "\n") {
+			records = append(records, strings.Split(strings.TrimSuffix(line, "\r"), "\t"))
+		}
+	} else {
+		r := csv.NewReader(bytes.NewReader(content))
+		r.Comma = comma
+		r.FieldsPerRecord = -1
+		r.LazyQuotes = true
+		var err error
+		if records, err = r.ReadAll(); err != nil {
+			return nil, err
+		}
+	}
+
+	t := &Table{}
+	if len(records) > 0 && (len(records) > 1 || len(records[0]) > 1 || records[0][0] != "") {
+		t.Header, t.Rows = records[0], records[1:]
+	}
+	return t, nil
+}
+
+// Columns returns the number of columns, that of the longest record.
+func (t *Table) Columns() int {
+	n := len(t.Header)
+	for _, row := range t.Rows {
+		n = max(n, len(row))
+	}
+	return n
+}
+
+// NoHeader makes the header the first row, for data that has none.
+func (t *Table) NoHeader() {
+	if t.Header != nil {
+		t.Rows = append([][]string{t.Header}, t.Rows...)
+		t.Header = nil
+	}
+}
+
+// column returns the index of a column, named by its header or by its
+// number, starting at 1.
+func (t *Table) column(name string) (int, error) {
+	name = strings.TrimSpace(name)
+	for i, h := range t.Header {
+		if strings.EqualFold(strings.TrimSpace(h), name) {
+			return i, nil
+		}
+	}
+	if n, err := strconv.Atoi(name); err == nil && n >= 1 && n <= t.Columns() {
+		return n - 1, nil
+	}
+	return 0, fmt.Errorf("no column %q", name)
+}
+
+// SelectColumns keeps the columns named, in the order given.
+func (t *Table) SelectColumns(names []string) error {
+	indexes := make([]int, len(names))
+	for i, name := range names {
+		index, err := t.column(name)
+		if err != nil {
+			return err
+		}
+		indexes[i] = index
+	}
+
+	pick := func(record []string) []string {
+		picked := make([]string, len(indexes))
+		for i, index := range indexes {
+			if index < len(record) {
+				picked[i] = record[index]
+			}
+		}
+		return picked
+	}
+	if t.Header != nil {
+		t.Header = pick(t.Header)
+	}
+	for i, row := range t.Rows {
+		t.Rows[i] = pick(row)
+	}
+	return nil
+}
+
+// Sort orders the rows by a column. Numbers are compared by value and
+// other values alphabetically, and empty cells always go last.
+func (t *Table) Sort(name string, descending bool) error {
+	index, err := t.column(name)
+	if err != nil {
+		return err
+	}
+
+	cell := func(row []string) string {
+		if index < len(row) {
+			return strings.TrimSpace(row[index])
+		}
+		return ""
+	}
+	sort.SliceStable(t.Rows, func(i, j int) bool {
+		a, b := cell(t.Rows[i]), cell(t.Rows[j])
+		if a == "" || b == "" {
+			return a != "" && b == ""
+		}
+		if x, ok := number(a); ok {
+			if y, ok := number(b); ok {
+				if descending {
+					return x > y
+				}
+				return x < y
+			}
+		}
+		a, b = strings.ToLower(a), strings.ToLower(b)
+		if descending {
+			return a > b
+		}
+		return a < b
+	})
+	return nil
+}
+
+// Truncate keeps the first n rows.
+func (t *Table) Truncate(n int) {
+	if n >= 0 && n < len(t.Rows) {
+		t.Rows = t.Rows[:n]
+	}
+}
+
+// HTML returns the table. Columns of numbers are aligned right. A sortable
+// table is marked for the script that sorts it by a clicked header.
+func (t *Table) HTML(sortable bool) string {
+	columns := t.Columns()
+	numeric := t.numericColumns(columns)
+
+	var b strings.Builder
+	if sortable {
+		b.WriteString("<table class=\"sortable\">\n")
+	} else {
+		b.WriteString("<table>\n")
+	}
+	if t.Header != nil {
+		b.WriteString("<thead>\n")
+		writeRow(&b, "th", t.Header, columns, numeric)
+		b.WriteString("</thead>\n")
+	}
+	if len(t.Rows) > 0 {
+		b.WriteString("<tbody>\n")
+		for _, row := range t.Rows {
+			writeRow(&b, "td", row, columns, numeric)
+		}
+		b.WriteString("</tbody>\n")
+	}
+	b.WriteString("</table>\n")
+	return b.String()
+}
+
+func writeRow(b *strings.Builder, cell string, row []string, columns int, numeric []bool) {
+	b.WriteString("<tr>\n")
+	for i := 0; i < columns; i++ {
+		value := ""
+		if i < len(row) {
+			value = row[i]
+		}
+		b.WriteString("<" + cell)
+		if numeric[i] {
+			b.WriteString(` style="text-align:right"`)
+		}
+		b.WriteString(">" + html.EscapeString(value) + "</" + cell + ">\n")
+	}
+	b.WriteString("</tr>\n")
+}
+
+// numericColumns reports which columns hold only numbers, apart from empty
+// cells.
+func (t *Table) numericColumns(columns int) []bool {
+	numeric := make([]bool, columns)
+	for i := range numeric {
+		found := false
+		numeric[i] = true
+		for _, row := range t.Rows {
+			if i >= len(row) || strings.TrimSpace(row[i]) == "" {
+				continue
+			}
+			if _, ok := number(row[i]); !ok {
+				numeric[i] = false
+				break
+			}
+			found = true
+		}
+		numeric[i] = numeric[i] && found
+	}
+	return numeric
+}
+
+// number reads a cell as a number, allowing thousands separators, a percent
+// sign and surrounding space.
+func number(s string) (float64, bool) {
+	s = strings.TrimSpace(s)
+	s = strings.TrimSuffix(s, "%")
+	s = strings.ReplaceAll(s, ",", "")
+	if s == "" {
+		return 0, false
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	return v, err == nil
+}
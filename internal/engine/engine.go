@@ -3,11 +3,13 @@ package engine
 import (
 	"fmt"
 	"os"
+	"time"
 
 	"blaze/internal/config"
 	"blaze/internal/markdown"
 	"blaze/internal/pipeline"
 	"blaze/internal/renderer"
+	"blaze/internal/utils"
 )
 
 type SSG struct {
@@ -16,22 +18,44 @@ type SSG struct {
 	OutputDir   string
 	ConfigPath  string
 	config      *config.Config
+	routes      *utils.Routes
 	pipeline    *pipeline.Pipeline
 }
 
-func NewSSG(contentDir, templateDir, outputDir, configPath string) (*SSG, error) {
+// BuildOptions include pages that are normally left out of the site, for
+// previews.
+type BuildOptions struct {
+	Drafts bool
+	Future bool
+}
+
+func NewSSG(contentDir, templateDir, outputDir, configPath string, opts BuildOptions) (*SSG, error) {
 	cfg, err := config.Load(configPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load config: %w", err)
 	}
+	cfg.Drafts = opts.Drafts
+	cfg.Future = opts.Future
+	cfg.BuildTime = time.Now()
 
-	htmlRenderer, err := renderer.NewHTMLRenderer(templateDir, cfg)
+	// Routes are filled in by the pipeline before any page is rendered.
+	routes := utils.NewRoutes(cfg.URLStyle, utils.NewSlugger(cfg.SlugMode))
+
+	htmlRenderer, err := renderer.NewHTMLRenderer(templateDir, cfg, routes)
 	if err != nil {
 		return nil, err
 	}
 
-	p := pipeline.NewPipeline(cfg, htmlRenderer)
-	p.RegisterTransformer(".md", markdown.NewTransformer())
+	p := pipeline.NewPipeline(cfg, htmlRenderer, routes)
+	p.RegisterTransformer(".md", markdown.NewTransformer(cfg, contentDir, routes))
+	p.RegisterTransformer(".canvas", markdown.NewCanvasTransformer(cfg, contentDir, routes))
+	p.RegisterTransformer(".excalidraw", markdown.NewExcalidrawTransformer())
+	p.RegisterTransformer(".excalidraw.md", markdown.NewExcalidrawTransformer())
+	p.RegisterTransformer(".html", markdown.NewHTMLTransformer(cfg))
+	p.RegisterTransformer(".txt", markdown.NewTextTransformer())
+	p.RegisterTransformer(".csv", markdown.NewTableTransformer(','))
+	p.RegisterTransformer(".tsv", markdown.NewTableTransformer('\t'))
+	p.RegisterTransformer(".ipynb", markdown.NewNotebookTransformer(cfg, contentDir, routes))
 
 	return &SSG{
 		ContentDir:  contentDir,
@@ -39,10 +63,22 @@ func NewSSG(contentDir, templateDir, outputDir, configPath string) (*SSG, error)
 		OutputDir:   outputDir,
 		ConfigPath:  configPath,
 		config:      cfg,
+		routes:      routes,
 		pipeline:    p,
 	}, nil
 }
 
+// Routes returns where each content file was written by the last Build.
+func (s *SSG) Routes() *utils.Routes {
+	return s.routes
+}
+
+// PageDigests returns the digest of every page written by the last build,
+// keyed by output path.
+func (s *SSG) PageDigests() map[string]string {
+	return s.pipeline.Digests()
+}
+
 func (s *SSG) Build() error {
 	fmt.Println("Building site...")
 
@@ -58,5 +94,17 @@ func (s *SSG) Build() error {
 		return err
 	}
 
+	if err := s.pipeline.CopyAssets(s.OutputDir); err != nil {
+		return err
+	}
+
+	if err := s.pipeline.GenerateNotFound(s.OutputDir); err != nil {
+		return err
+	}
+
+	if err := s.pipeline.GenerateSyntaxCSS(s.OutputDir); err != nil {
+		return err
+	}
+
 	return s.pipeline.ProcessTemplates(s.TemplateDir, s.OutputDir)
 }
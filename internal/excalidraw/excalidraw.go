@@ -0,0 +1,88 @@
+// Package excalidraw renders Excalidraw drawings to SVG, from .excalidraw
+// files and from the .excalidraw.md notes of Obsidian's Excalidraw plugin.
+package excalidraw
+
+import (
+	"encoding/json"
+	"errors"
+	"regexp"
+	"strings"
+)
+
+// Drawing is an Excalidraw scene.
+type Drawing struct {
+	Elements []Element       `json:"elements"`
+	AppState AppState        `json:"appState"`
+	Files    map[string]File `json:"files"`
+}
+
+type AppState struct {
+	ViewBackgroundColor string `json:"viewBackgroundColor"`
+}
+
+// File is an image placed in a drawing.
+type File struct {
+	MimeType string `json:"mimeType"`
+	DataURL  string `json:"dataURL"`
+}
+
+// Element is a shape, line, text or image of a drawing. Only the fields
+// that affect how it looks are read.
+type Element struct {
+	Type            string       `json:"type"`
+	X               float64      `json:"x"`
+	Y               float64      `json:"y"`
+	Width           float64      `json:"width"`
+	Height          float64      `json:"height"`
+	Angle           float64      `json:"angle"`
+	StrokeColor     string       `json:"strokeColor"`
+	BackgroundColor string       `json:"backgroundColor"`
+	FillStyle       string       `json:"fillStyle"`
+	StrokeWidth     float64      `json:"strokeWidth"`
+	StrokeStyle     string       `json:"strokeStyle"`
+	Opacity         *float64     `json:"opacity"`
+	Roundness       *struct{}    `json:"roundness"`
+	IsDeleted       bool         `json:"isDeleted"`
+	Points          [][2]float64 `json:"points"`
+	StartArrowhead  string       `json:"startArrowhead"`
+	EndArrowhead    string       `json:"endArrowhead"`
+	Text            string       `json:"text"`
+	FontSize        float64      `json:"fontSize"`
+	FontFamily      int          `json:"fontFamily"`
+	TextAlign       string       `json:"textAlign"`
+	VerticalAlign   string       `json:"verticalAlign"`
+	LineHeight      float64      `json:"lineHeight"`
+	FileID          string       `json:"fileId"`
+	Name            string       `json:"name"`
+}
+
+// reDrawing matches the drawing block of an .excalidraw.md note.
+var reDrawing = regexp.MustCompile("(?s)```(compressed-json|json)\\s*\\n(.*?)\\n```")
+
+var errNoDrawing = errors.New("no drawing found")
+
+// Parse reads an .excalidraw file, or an .excalidraw.md note with its
+// drawing in a json or compressed-json block.
+func Parse(content []byte) (*Drawing, error) {
+	data := content
+	if trimmed := strings.TrimSpace(string(content)); !strings.HasPrefix(trimmed, "{") {
+		m := reDrawing.FindSubmatch(content)
+		if m == nil {
+			return nil, errNoDrawing
+		}
+		data = m[2]
+		if string(m[1]) == "compressed-json" {
+			decompressed, err := decompressFromBase64(string(data))
+			if err != nil {
+				return nil, err
+			}
+			data = []byte(decompressed)
+		}
+	}
+
+	var d Drawing
+	if err := json.Unmarshal(data, &d); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
@@ -0,0 +1,137 @@
+package excalidraw
+
+import (
+	"errors"
+	"unicode/utf16"
+)
+
+// Obsidian's Excalidraw plugin stores drawings compressed with lz-string,
+// in the base64 form of its compressToBase64.
+
+const base64Alphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/="
+
+var base64Values = func() [256]int {
+	var values [256]int
+	for i := range values {
+		values[i] = -1
+	}
+	for i := 0; i < len(base64Alphabet); i++ {
+		values[base64Alphabet[i]] = i
+	}
+	return values
+}()
+
+var errCorrupt = errors.New("corrupt compressed drawing")
+
+// decompressFromBase64 is lz-string's decompressFromBase64.
+func decompressFromBase64(input string) (string, error) {
+	var chars []byte
+	for i := 0; i < len(input); i++ {
+		if base64Values[input[i]] >= 0 {
+			chars = append(chars, input[i])
+		}
+	}
+	if len(chars) == 0 {
+		return "", errCorrupt
+	}
+
+	r := &bitReader{chars: chars, position: 32, value: base64Values[chars[0]], index: 1}
+	units, err := r.decompress()
+	if err != nil {
+		return "", err
+	}
+	return string(utf16.Decode(units)), nil
+}
+
+// bitReader reads the bits of the base64 characters, 6 to a character from
+// the highest, as lz-string writes them.
+type bitReader struct {
+	chars    []byte
+	value    int
+	position int
+	index    int
+}
+
+func (r *bitReader) read(n int) int {
+	bits := 0
+	for power := 1; power != 1<<n; power <<= 1 {
+		if r.value&r.position > 0 {
+			bits |= power
+		}
+		r.position >>= 1
+		if r.position == 0 {
+			r.position = 32
+			r.value = 0
+			if r.index < len(r.chars) {
+				r.value = base64Values[r.chars[r.index]]
+			}
+			r.index++
+		}
+	}
+	return bits
+}
+
+func (r *bitReader) decompress() ([]uint16, error) {
+	// Codes 0, 1 and 2 are reserved: a new 8-bit character, a new 16-bit
+	// character and the end of the stream.
+	dictionary := [][]uint16{nil, nil, nil}
+	enlargeIn := 4
+	numBits := 3
+
+	var w []uint16
+	switch r.read(2) {
+	case 0:
+		w = []uint16{uint16(r.read(8))}
+	case 1:
+		w = []uint16{uint16(r.read(16))}
+	default:
+		return nil, nil
+	}
+	dictionary = append(dictionary, w)
+	result := append([]uint16(nil), w...)
+
+	for {
+		if r.index > len(r.chars) {
+			return nil, errCorrupt
+		}
+
+		code := r.read(numBits)
+		switch code {
+		case 0, 1:
+			size := 8
+			if code == 1 {
+				size = 16
+			}
+			dictionary = append(dictionary, []uint16{uint16(r.read(size))})
+			code = len(dictionary) - 1
+			enlargeIn--
+		case 2:
+			return result, nil
+		}
+
+		if enlargeIn == 0 {
+			enlargeIn = 1 << numBits
+			numBits++
+		}
+
+		var entry []uint16
+		switch {
+		case code < len(dictionary):
+			entry = dictionary[code]
+		case code == len(dictionary):
+			entry = append(append([]uint16(nil), w...), w[0])
+		default:
+			return nil, errCorrupt
+		}
+		result = append(result, entry...)
+
+		dictionary = append(dictionary, append(append([]uint16(nil), w...), entry[0]))
+		enlargeIn--
+		w = entry
+
+		if enlargeIn == 0 {
+			enlargeIn = 1 << numBits
+			numBits++
+		}
+	}
+}
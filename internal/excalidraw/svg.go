@@ -0,0 +1,384 @@
+package excalidraw
+
+import (
+	"fmt"
+	"html"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// padding is the margin around the drawing, in drawing units.
+const padding = 10
+
+// reColor matches the colors Excalidraw writes: hex, named and rgb().
+// Anything else is replaced, since colors are written into attributes.
+var reColor = regexp.MustCompile(`^(#[0-9a-fA-F]{3,8}|[a-zA-Z]+|rgba?\([0-9.,\s%]+\))$`)
+
+// fontFamilies are the CSS fonts of Excalidraw's font numbers. The drawing
+// fonts are only used when the reader has them installed.
+var fontFamilies = map[int]string{
+	1: `Virgil, Excalifont, "Comic Sans MS", cursive`,
+	2: `Helvetica, Arial, sans-serif`,
+	3: `Cascadia, "Cascadia Code", monospace`,
+	5: `Excalifont, Virgil, "Comic Sans MS", cursive`,
+	6: `Nunito, Helvetica, Arial, sans-serif`,
+	7: `"Lilita One", Helvetica, Arial, sans-serif`,
+	8: `"Comic Shanns", "Cascadia Code", monospace`,
+}
+
+// SVG renders the drawing. The ids of the patterns it defines start with
+// prefix, so that several drawings can be inlined in one page.
+func (d *Drawing) SVG(prefix string) string {
+	r := &svgRenderer{prefix: prefix, files: d.Files}
+
+	var elements []Element
+	for _, e := range d.Elements {
+		if !e.IsDeleted {
+			elements = append(elements, e)
+		}
+	}
+
+	minX, minY, maxX, maxY := math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)
+	for _, e := range elements {
+		x1, y1, x2, y2 := e.bounds()
+		minX, minY = math.Min(minX, x1), math.Min(minY, y1)
+		maxX, maxY = math.Max(maxX, x2), math.Max(maxY, y2)
+	}
+	if len(elements) == 0 {
+		minX, minY, maxX, maxY = 0, 0, 0, 0
+	}
+	minX, minY, maxX, maxY = minX-padding, minY-padding, maxX+padding, maxY+padding
+	width, height := maxX-minX, maxY-minY
+
+	var body strings.Builder
+	for _, e := range elements {
+		r.element(&body, e)
+	}
+
+	background := d.AppState.ViewBackgroundColor
+	if background == "" {
+		background = "#ffffff"
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" class="excalidraw" viewBox="%s %s %s %s" width="%s" height="%s">`,
+		num(minX), num(minY), num(width), num(height), num(width), num(height))
+	if r.defs.Len() > 0 {
+		b.WriteString("<defs>" + r.defs.String() + "</defs>")
+	}
+	fmt.Fprintf(&b, `<rect x="%s" y="%s" width="%s" height="%s" fill="%s"/>`,
+		num(minX), num(minY), num(width), num(height), safeColor(background, "#ffffff"))
+	b.WriteString(body.String())
+	b.WriteString("</svg>")
+	return b.String()
+}
+
+// bounds returns the box the element covers once rotated.
+func (e Element) bounds() (x1, y1, x2, y2 float64) {
+	x1, y1, x2, y2 = e.box()
+	if e.Angle == 0 {
+		return x1, y1, x2, y2
+	}
+
+	cx, cy := (x1+x2)/2, (y1+y2)/2
+	sin, cos := math.Sincos(e.Angle)
+	corners := [][2]float64{{x1, y1}, {x2, y1}, {x1, y2}, {x2, y2}}
+	x1, y1, x2, y2 = math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)
+	for _, c := range corners {
+		dx, dy := c[0]-cx, c[1]-cy
+		x, y := cx+dx*cos-dy*sin, cy+dx*sin+dy*cos
+		x1, y1, x2, y2 = math.Min(x1, x), math.Min(y1, y), math.Max(x2, x), math.Max(y2, y)
+	}
+	return x1, y1, x2, y2
+}
+
+// box returns the box of the element before rotation. Lines are measured
+// by their points, which are relative to x and y.
+func (e Element) box() (x1, y1, x2, y2 float64) {
+	if len(e.Points) == 0 {
+		return e.X, e.Y, e.X + e.Width, e.Y + e.Height
+	}
+	x1, y1, x2, y2 = math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)
+	for _, p := range e.Points {
+		x1, y1 = math.Min(x1, e.X+p[0]), math.Min(y1, e.Y+p[1])
+		x2, y2 = math.Max(x2, e.X+p[0]), math.Max(y2, e.Y+p[1])
+	}
+	return x1, y1, x2, y2
+}
+
+type svgRenderer struct {
+	prefix   string
+	files    map[string]File
+	defs     strings.Builder
+	patterns int
+}
+
+func (r *svgRenderer) element(b *strings.Builder, e Element) {
+	var shape string
+	switch e.Type {
+	case "rectangle":
+		radius := 0.0
+		if e.Roundness != nil {
+			radius = math.Min(32, math.Min(math.Abs(e.Width), math.Abs(e.Height))/4)
+		}
+		shape = fmt.Sprintf(`<rect x="%s" y="%s" width="%s" height="%s" rx="%s"%s/>`,
+			num(e.X), num(e.Y), num(e.Width), num(e.Height), num(radius), r.paint(e))
+	case "ellipse":
+		shape = fmt.Sprintf(`<ellipse cx="%s" cy="%s" rx="%s" ry="%s"%s/>`,
+			num(e.X+e.Width/2), num(e.Y+e.Height/2), num(e.Width/2), num(e.Height/2), r.paint(e))
+	case "diamond":
+		shape = fmt.Sprintf(`<polygon points="%s,%s %s,%s %s,%s %s,%s"%s/>`,
+			num(e.X+e.Width/2), num(e.Y), num(e.X+e.Width), num(e.Y+e.Height/2),
+			num(e.X+e.Width/2), num(e.Y+e.Height), num(e.X), num(e.Y+e.Height/2), r.paint(e))
+	case "line", "arrow", "freedraw":
+		shape = r.line(e)
+	case "text":
+		shape = text(e)
+	case "image":
+		shape = r.image(e)
+	case "frame", "magicframe":
+		name := e.Name
+		if name == "" {
+			name = "Frame"
+		}
+		shape = fmt.Sprintf(`<rect x="%s" y="%s" width="%s" height="%s" fill="none" stroke="#bbb" stroke-dasharray="8 4"/>`+
+			`<text x="%s" y="%s" font-family="%s" font-size="14" fill="#999">%s</text>`,
+			num(e.X), num(e.Y), num(e.Width), num(e.Height),
+			num(e.X), num(e.Y-6), html.EscapeString(fontFamilies[2]), html.EscapeString(name))
+	default:
+		return
+	}
+	if shape == "" {
+		return
+	}
+
+	var attrs string
+	if e.Angle != 0 {
+		x1, y1, x2, y2 := e.box()
+		attrs += fmt.Sprintf(` transform="rotate(%s %s %s)"`, num(e.Angle*180/math.Pi), num((x1+x2)/2), num((y1+y2)/2))
+	}
+	if e.Opacity != nil && *e.Opacity < 100 {
+		attrs += fmt.Sprintf(` opacity="%s"`, num(*e.Opacity/100))
+	}
+	fmt.Fprintf(b, "<g%s>%s</g>", attrs, shape)
+}
+
+// paint returns the fill and stroke attributes of a shape.
+func (r *svgRenderer) paint(e Element) string {
+	return fmt.Sprintf(` fill="%s"%s`, r.fill(e), stroke(e))
+}
+
+// fill returns the fill of a shape: its background color, or a pattern of
+// lines for the hachure and cross-hatch styles.
+func (r *svgRenderer) fill(e Element) string {
+	color := safeColor(e.BackgroundColor, "none")
+	if color == "none" || color == "transparent" {
+		return "none"
+	}
+	if e.FillStyle == "solid" {
+		return color
+	}
+
+	r.patterns++
+	id := fmt.Sprintf("%s-fill-%d", r.prefix, r.patterns)
+	fmt.Fprintf(&r.defs, `<pattern id="%s" patternUnits="userSpaceOnUse" width="8" height="8" patternTransform="rotate(-45)">`, id)
+	fmt.Fprintf(&r.defs, `<line x1="0" y1="0" x2="0" y2="8" stroke="%s" stroke-width="1.5"/>`, color)
+	if e.FillStyle == "cross-hatch" {
+		fmt.Fprintf(&r.defs, `<line x1="0" y1="0" x2="8" y2="0" stroke="%s" stroke-width="1.5"/>`, color)
+	}
+	r.defs.WriteString("</pattern>")
+	return "url(#" + id + ")"
+}
+
+// stroke returns the stroke attributes of an element.
+func stroke(e Element) string {
+	width := e.StrokeWidth
+	if width == 0 {
+		width = 1
+	}
+	attrs := fmt.Sprintf(` stroke="%s" stroke-width="%s" stroke-linecap="round" stroke-linejoin="round"`,
+		safeColor(e.StrokeColor, "#1e1e1e"), num(width))
+	switch e.StrokeStyle {
+	case "dashed":
+		attrs += fmt.Sprintf(` stroke-dasharray="8 %s"`, num(8+width))
+	case "dotted":
+		attrs += fmt.Sprintf(` stroke-dasharray="1.5 %s"`, num(6+width))
+	}
+	return attrs
+}
+
+// line renders lines, arrows and freehand strokes.
+func (r *svgRenderer) line(e Element) string {
+	if len(e.Points) < 2 {
+		return ""
+	}
+	points := make([][2]float64, len(e.Points))
+	for i, p := range e.Points {
+		points[i] = [2]float64{e.X + p[0], e.Y + p[1]}
+	}
+
+	var d string
+	if e.Roundness != nil && e.Type != "freedraw" {
+		d = smoothPath(points)
+	} else {
+		d = polyline(points)
+	}
+
+	// A line whose ends meet is a shape, and filled.
+	fill := "none"
+	first, last := points[0], points[len(points)-1]
+	if e.Type == "line" && len(points) > 2 && math.Hypot(first[0]-last[0], first[1]-last[1]) < 1 {
+		fill = r.fill(e)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<path d="%s" fill="%s"%s/>`, d, fill, stroke(e))
+	if e.Type == "arrow" {
+		b.WriteString(arrowhead(e, e.EndArrowhead, points[len(points)-1], previous(points, len(points)-1, -1)))
+		b.WriteString(arrowhead(e, e.StartArrowhead, points[0], previous(points, 0, 1)))
+	}
+	return b.String()
+}
+
+// previous returns the first point from i, going in step, that is not at
+// the same place as point i, to find the direction of the line there.
+func previous(points [][2]float64, i, step int) [2]float64 {
+	for j := i + step; j >= 0 && j < len(points); j += step {
+		if points[j] != points[i] {
+			return points[j]
+		}
+	}
+	return points[i]
+}
+
+// arrowhead draws the head of kind at tip, for a line coming from from.
+func arrowhead(e Element, kind string, tip, from [2]float64) string {
+	if kind == "" || tip == from {
+		return ""
+	}
+	width := math.Max(e.StrokeWidth, 1)
+	size := 10 + 3*width
+	angle := math.Atan2(tip[1]-from[1], tip[0]-from[0])
+	at := func(a, length float64) string {
+		return num(tip[0]-length*math.Cos(angle+a)) + "," + num(tip[1]-length*math.Sin(angle+a))
+	}
+	tipPoint := num(tip[0]) + "," + num(tip[1])
+	color := safeColor(e.StrokeColor, "#1e1e1e")
+
+	switch kind {
+	case "triangle", "triangle_outline":
+		fill := color
+		if kind == "triangle_outline" {
+			fill = "none"
+		}
+		return fmt.Sprintf(`<polygon points="%s %s %s" fill="%s"%s/>`, tipPoint, at(0.4, size), at(-0.4, size), fill, stroke(e))
+	case "bar":
+		return fmt.Sprintf(`<polyline points="%s %s" fill="none"%s/>`, at(math.Pi/2, size/2), at(-math.Pi/2, size/2), stroke(e))
+	case "dot", "circle", "circle_outline":
+		fill := color
+		if kind == "circle_outline" {
+			fill = "none"
+		}
+		center := [2]float64{tip[0] - size/3*math.Cos(angle), tip[1] - size/3*math.Sin(angle)}
+		return fmt.Sprintf(`<circle cx="%s" cy="%s" r="%s" fill="%s"%s/>`, num(center[0]), num(center[1]), num(size/3), fill, stroke(e))
+	case "diamond", "diamond_outline":
+		fill := color
+		if kind == "diamond_outline" {
+			fill = "none"
+		}
+		return fmt.Sprintf(`<polygon points="%s %s %s %s" fill="%s"%s/>`,
+			tipPoint, at(0.35, size*0.6), at(0, size*1.1), at(-0.35, size*0.6), fill, stroke(e))
+	default:
+		return fmt.Sprintf(`<polyline points="%s %s %s" fill="none"%s/>`, at(0.5, size), tipPoint, at(-0.5, size), stroke(e))
+	}
+}
+
+func polyline(points [][2]float64) string {
+	var b strings.Builder
+	for i, p := range points {
+		if i == 0 {
+			b.WriteString("M")
+		} else {
+			b.WriteString(" L")
+		}
+		b.WriteString(num(p[0]) + " " + num(p[1]))
+	}
+	return b.String()
+}
+
+// smoothPath draws a curve through the points, as Excalidraw does for
+// rounded lines, with Catmull-Rom splines.
+func smoothPath(points [][2]float64) string {
+	if len(points) < 3 {
+		return polyline(points)
+	}
+	var b strings.Builder
+	b.WriteString("M" + num(points[0][0]) + " " + num(points[0][1]))
+	for i := 0; i < len(points)-1; i++ {
+		p0 := points[max(i-1, 0)]
+		p1, p2 := points[i], points[i+1]
+		p3 := points[min(i+2, len(points)-1)]
+		c1 := [2]float64{p1[0] + (p2[0]-p0[0])/6, p1[1] + (p2[1]-p0[1])/6}
+		c2 := [2]float64{p2[0] - (p3[0]-p1[0])/6, p2[1] - (p3[1]-p1[1])/6}
+		fmt.Fprintf(&b, " C%s %s, %s %s, %s %s", num(c1[0]), num(c1[1]), num(c2[0]), num(c2[1]), num(p2[0]), num(p2[1]))
+	}
+	return b.String()
+}
+
+func text(e Element) string {
+	size := e.FontSize
+	if size == 0 {
+		size = 20
+	}
+	lineHeight := e.LineHeight
+	if lineHeight == 0 {
+		lineHeight = 1.25
+	}
+	family, ok := fontFamilies[e.FontFamily]
+	if !ok {
+		family = fontFamilies[1]
+	}
+
+	x, anchor := e.X, "start"
+	switch e.TextAlign {
+	case "center":
+		x, anchor = e.X+e.Width/2, "middle"
+	case "right":
+		x, anchor = e.X+e.Width, "end"
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<text font-family="%s" font-size="%s" fill="%s" text-anchor="%s" dominant-baseline="middle">`,
+		html.EscapeString(family), num(size), safeColor(e.StrokeColor, "#1e1e1e"), anchor)
+	for i, line := range strings.Split(e.Text, "\n") {
+		y := e.Y + (float64(i)+0.5)*size*lineHeight
+		fmt.Fprintf(&b, `<tspan x="%s" y="%s">%s</tspan>`, num(x), num(y), html.EscapeString(line))
+	}
+	b.WriteString("</text>")
+	return b.String()
+}
+
+// image renders a picture placed in the drawing, stored in the drawing as
+// a data URL.
+func (r *svgRenderer) image(e Element) string {
+	file, ok := r.files[e.FileID]
+	if !ok || !strings.HasPrefix(file.DataURL, "data:image/") {
+		return ""
+	}
+	return fmt.Sprintf(`<image href="%s" x="%s" y="%s" width="%s" height="%s" preserveAspectRatio="none"/>`,
+		html.EscapeString(file.DataURL), num(e.X), num(e.Y), num(e.Width), num(e.Height))
+}
+
+func safeColor(color, fallback string) string {
+	if color == "" || !reColor.MatchString(color) {
+		return fallback
+	}
+	return color
+}
+
+// num formats a coordinate, rounded to hundredths.
+func num(v float64) string {
+	return strconv.FormatFloat(math.Round(v*100)/100, 'f', -1, 64)
+}
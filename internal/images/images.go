@@ -0,0 +1,286 @@
+// Package images generates the resized variants of the images of a site,
+// which pages offer to browsers in srcset so that small screens don't
+// download full-size photos.
+package images
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// cacheVersion is part of every cache key. Bump it when the output of
+// resizing changes, so variants cached by older versions are not reused.
+const cacheVersion = 1
+
+// Options are the variants generated for each image.
+type Options struct {
+	// Widths are the widths of the variants. Images are never enlarged, so
+	// an image only gets the variants narrower than itself.
+	Widths []int
+	// Quality is the JPEG quality of the variants, from 1 to 100.
+	Quality int
+	// Sizes is the sizes attribute of images shown at the width of the page.
+	Sizes string
+	// CacheDir keeps the variants between builds, by the hash of the image
+	// and the options. Empty disables the cache.
+	CacheDir string
+}
+
+// Info is the size of an image and the variants generated for it.
+type Info struct {
+	// Width and Height are the intrinsic size, as displayed: swapped for
+	// photos the camera stored rotated.
+	Width, Height int
+	// Variants are sorted from the narrowest.
+	Variants []Variant
+	Sizes    string
+}
+
+// Variant is a resized copy of an image.
+type Variant struct {
+	Width, Height int
+}
+
+// Processor reads images and generates their variants. It is safe for
+// concurrent use.
+type Processor struct {
+	opts  Options
+	infos sync.Map // path -> infoResult
+}
+
+type infoResult struct {
+	info Info
+	err  error
+}
+
+func NewProcessor(opts Options) *Processor {
+	widths := append([]int(nil), opts.Widths...)
+	sort.Ints(widths)
+	opts.Widths = widths
+	return &Processor{opts: opts}
+}
+
+// IsResizable reports whether the image at path is in a format variants
+// are generated for.
+func IsResizable(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".jpg", ".jpeg", ".png", ".gif":
+		return true
+	}
+	return false
+}
+
+// VariantPath returns the path or URL of the variant of an image with the
+// given width: photo.jpg becomes photo-480w.jpg.
+func VariantPath(path string, width int) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "-" + strconv.Itoa(width) + "w" + ext
+}
+
+// Srcset returns the srcset attribute of the image at url: its variants
+// and the image itself.
+func (i Info) Srcset(url string) string {
+	if len(i.Variants) == 0 {
+		return ""
+	}
+	var candidates []string
+	for _, v := range i.Variants {
+		candidates = append(candidates, fmt.Sprintf("%s %dw", VariantPath(url, v.Width), v.Width))
+	}
+	candidates = append(candidates, fmt.Sprintf("%s %dw", url, i.Width))
+	return strings.Join(candidates, ", ")
+}
+
+// Info returns the size and variants of the image at path, which is read
+// once.
+func (p *Processor) Info(path string) (Info, error) {
+	if cached, ok := p.infos.Load(path); ok {
+		r := cached.(infoResult)
+		return r.info, r.err
+	}
+	info, err := p.readInfo(path)
+	p.infos.Store(path, infoResult{info, err})
+	return info, err
+}
+
+func (p *Processor) readInfo(path string) (Info, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Info{}, err
+	}
+	return p.info(data)
+}
+
+func (p *Processor) info(data []byte) (Info, error) {
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return Info{}, err
+	}
+
+	info := Info{Width: config.Width, Height: config.Height, Sizes: p.opts.Sizes}
+	if format == "jpeg" && exifOrientation(data) >= 5 {
+		info.Width, info.Height = info.Height, info.Width
+	}
+
+	// Resizing an animated GIF would keep only its first frame.
+	if format == "gif" {
+		if anim, err := gif.DecodeAll(bytes.NewReader(data)); err != nil || len(anim.Image) > 1 {
+			return info, nil
+		}
+	}
+
+	for _, width := range p.opts.Widths {
+		if width <= 0 || width >= info.Width {
+			continue
+		}
+		height := max(1, (info.Height*width+info.Width/2)/info.Width)
+		info.Variants = append(info.Variants, Variant{Width: width, Height: height})
+	}
+	return info, nil
+}
+
+// Generate writes the variants of the image at sourcePath next to
+// outputPath, where the image itself is copied, and returns their paths.
+// Variants found in the cache are copied from it instead of resized.
+func (p *Processor) Generate(sourcePath, outputPath string) ([]string, error) {
+	data, err := os.ReadFile(sourcePath)
+	if err != nil {
+		return nil, err
+	}
+	info, err := p.info(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(info.Variants) == 0 {
+		return nil, nil
+	}
+
+	hash := sha256.Sum256(data)
+	ext := strings.ToLower(filepath.Ext(sourcePath))
+
+	var source *decoded
+	var written []string
+	for _, v := range info.Variants {
+		cachePath := p.cachePath(hash[:], v, ext)
+		variantPath := VariantPath(outputPath, v.Width)
+
+		resized, err := p.readCache(cachePath)
+		if err != nil {
+			if source == nil {
+				if source, err = decode(data); err != nil {
+					return written, err
+				}
+			}
+			if resized, err = p.encode(source, v, ext); err != nil {
+				return written, err
+			}
+			p.writeCache(cachePath, resized)
+		}
+
+		if err := os.WriteFile(variantPath, resized, 0644); err != nil {
+			return written, err
+		}
+		written = append(written, variantPath)
+	}
+	return written, nil
+}
+
+// decoded is an image and the EXIF orientation it is stored in.
+type decoded struct {
+	image       image.Image
+	orientation int
+}
+
+func decode(data []byte) (*decoded, error) {
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	d := &decoded{image: img, orientation: 1}
+	if format == "jpeg" {
+		d.orientation = exifOrientation(data)
+	}
+	return d, nil
+}
+
+// encode resizes an image to the variant, in the format of ext. The image
+// is turned upright after resizing, which is cheaper than before.
+func (p *Processor) encode(d *decoded, v Variant, ext string) ([]byte, error) {
+	w, h := v.Width, v.Height
+	if d.orientation >= 5 {
+		w, h = h, w
+	}
+	resized := orient(resize(d.image, w, h), d.orientation)
+
+	var buf bytes.Buffer
+	var err error
+	switch ext {
+	case ".jpg", ".jpeg":
+		err = jpeg.Encode(&buf, resized, &jpeg.Options{Quality: p.opts.Quality})
+	case ".png":
+		err = png.Encode(&buf, resized)
+	case ".gif":
+		err = gif.Encode(&buf, resized, nil)
+	default:
+		err = fmt.Errorf("unsupported image format %s", ext)
+	}
+	return buf.Bytes(), err
+}
+
+// cachePath returns where the variant of the image with the given hash is
+// cached, or "" without a cache.
+func (p *Processor) cachePath(hash []byte, v Variant, ext string) string {
+	if p.opts.CacheDir == "" {
+		return ""
+	}
+	key := sha256.New()
+	key.Write(hash)
+	fmt.Fprintf(key, "v%d w%d h%d q%d", cacheVersion, v.Width, v.Height, p.opts.Quality)
+	return filepath.Join(p.opts.CacheDir, hex.EncodeToString(key.Sum(nil))[:32]+ext)
+}
+
+func (p *Processor) readCache(path string) ([]byte, error) {
+	if path == "" {
+		return nil, os.ErrNotExist
+	}
+	return os.ReadFile(path)
+}
+
+// writeCache stores a variant. Failing to is not an error: the next build
+// resizes the image again.
+func (p *Processor) writeCache(path string, data []byte) {
+	if path == "" {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return
+	}
+	// Written under another name first, so that concurrent builds never
+	// read a partial file.
+	tmp, err := os.CreateTemp(filepath.Dir(path), "variant-*")
+	if err != nil {
+		return
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+}
@@ -0,0 +1,187 @@
+package images
+
+import (
+	"encoding/binary"
+	"image"
+	"image/draw"
+	"math"
+)
+
+// resize scales img down to w×h. Each pixel is the average of the source
+// pixels it covers, weighted by how much of each it covers, which keeps
+// fine detail from aliasing. Colors are averaged premultiplied by alpha, so
+// transparent pixels don't darken the edges of what they surround.
+func resize(img image.Image, w, h int) *image.RGBA {
+	b := img.Bounds()
+	src, ok := img.(*image.RGBA)
+	if !ok || src.Rect.Min != (image.Point{}) {
+		src = image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+		draw.Draw(src, src.Rect, img, b.Min, draw.Src)
+	}
+	sw, sh := src.Rect.Dx(), src.Rect.Dy()
+
+	// Horizontal pass, into sh rows of w pixels.
+	columns := coverage(sw, w)
+	tmp := make([]float32, w*sh*4)
+	for y := 0; y < sh; y++ {
+		row := src.Pix[y*src.Stride:]
+		for x, contribs := range columns {
+			var c [4]float32
+			for _, cw := range contribs {
+				p := row[cw.index*4:]
+				for i := range c {
+					c[i] += float32(p[i]) * cw.weight
+				}
+			}
+			copy(tmp[(y*w+x)*4:], c[:])
+		}
+	}
+
+	// Vertical pass.
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	rows := coverage(sh, h)
+	for y, contribs := range rows {
+		for x := 0; x < w; x++ {
+			var c [4]float32
+			for _, cw := range contribs {
+				p := tmp[(cw.index*w+x)*4:]
+				for i := range c {
+					c[i] += p[i] * cw.weight
+				}
+			}
+			out := dst.Pix[y*dst.Stride+x*4:]
+			for i := range c {
+				out[i] = uint8(min(255, math.Round(float64(c[i]))))
+			}
+		}
+	}
+	return dst
+}
+
+// contribution is the share of a source pixel in a destination pixel.
+type contribution struct {
+	index  int
+	weight float32
+}
+
+// coverage returns, for each of the dst pixels a row or column of src
+// pixels is scaled down to, the source pixels it covers.
+func coverage(src, dst int) [][]contribution {
+	scale := float64(src) / float64(dst)
+	out := make([][]contribution, dst)
+	for i := range out {
+		start, end := float64(i)*scale, float64(i+1)*scale
+		for j := int(start); j < src && float64(j) < end; j++ {
+			covered := math.Min(end, float64(j+1)) - math.Max(start, float64(j))
+			if covered > 0 {
+				out[i] = append(out[i], contribution{j, float32(covered / scale)})
+			}
+		}
+	}
+	return out
+}
+
+// orient turns an image upright given its EXIF orientation, from 1 (already
+// upright) to 8.
+func orient(img image.Image, orientation int) image.Image {
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // mirrored
+				dx, dy = w-1-x, y
+			case 3: // rotated 180°
+				dx, dy = w-1-x, h-1-y
+			case 4: // mirrored vertically
+				dx, dy = x, h-1-y
+			case 5: // transposed
+				dx, dy = y, x
+			case 6: // turned clockwise
+				dx, dy = h-1-y, x
+			case 7: // transversed
+				dx, dy = h-1-y, w-1-x
+			case 8: // turned counterclockwise
+				dx, dy = y, w-1-x
+			}
+			dst.Set(dx, dy, img.At(b.Min.X+x, b.Min.Y+y))
+		}
+	}
+	return dst
+}
+
+// exifOrientation returns the orientation a camera recorded in the EXIF
+// data of a JPEG, or 1 when there is none.
+func exifOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			return 1
+		}
+		marker := data[i+1]
+		if marker == 0xDA || marker == 0xD9 {
+			// The image data starts: EXIF comes before it.
+			return 1
+		}
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		end := i + 2 + length
+		if length < 2 || end > len(data) {
+			return 1
+		}
+		segment := data[i+4 : end]
+		if marker == 0xE1 && len(segment) > 6 && string(segment[:6]) == "Exif\x00\x00" {
+			return tiffOrientation(segment[6:])
+		}
+		i = end
+	}
+	return 1
+}
+
+// tiffOrientation reads the orientation tag of the first directory of the
+// TIFF structure EXIF data is stored in.
+func tiffOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	offset := int(order.Uint32(tiff[4:]))
+	if offset+2 > len(tiff) {
+		return 1
+	}
+	entries := int(order.Uint16(tiff[offset:]))
+	for e := 0; e < entries; e++ {
+		entry := offset + 2 + e*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			if o := int(order.Uint16(tiff[entry+8:])); o >= 1 && o <= 8 {
+				return o
+			}
+			return 1
+		}
+	}
+	return 1
+}
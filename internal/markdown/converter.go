@@ -1,58 +1,127 @@
 package markdown
 
 import (
+	"blaze/internal/config"
+	"blaze/internal/images"
 	"blaze/internal/markdown/extensions"
 	"blaze/internal/markdown/highlighting"
+	"blaze/internal/utils"
 	"bytes"
 
 	"github.com/yuin/goldmark"
 	meta "github.com/yuin/goldmark-meta"
 	"github.com/yuin/goldmark/extension"
 	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
 	"github.com/yuin/goldmark/renderer/html"
 
 	chromahtml "github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/alecthomas/chroma/v2/styles"
 )
 
-func newGoldmark() goldmark.Markdown {
-	return goldmark.New(
-		goldmark.WithExtensions(
-			extension.GFM,
-			extension.Table,
-			extension.Strikethrough,
-			extension.TaskList,
-			extension.Footnote,
-			extensions.ObsidianHighlight,
-			extensions.Mermaid,
-			extensions.Katex,
-			extensions.Wikilink(extensions.NewSlugResolver("content")),
-			extensions.Youtube,
-			extensions.HeadingShift,
-			extensions.Anchor,
-			extensions.Callout,
-			highlighting.NewHighlighting(
-				highlighting.WithFormatOptions(
-					chromahtml.WithClasses(true),
-				),
-				highlighting.WithGuessLanguage(true),
-			),
-			meta.Meta,
+// formatOptions are the options code blocks are highlighted with. Colors
+// come from classes, styled by SyntaxCSS.
+var formatOptions = []chromahtml.Option{
+	chromahtml.WithClasses(true),
+}
+
+// SyntaxCSS returns the stylesheet for highlighted code, in the light and
+// dark styles of the config.
+func SyntaxCSS(cfg *config.Config) ([]byte, error) {
+	var buf bytes.Buffer
+	light, dark := styles.Get(cfg.SyntaxLight), styles.Get(cfg.SyntaxDark)
+	if err := highlighting.WriteThemeCSS(&buf, light, dark, formatOptions...); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// ImageOptions returns the responsive image settings of the config.
+func ImageOptions(cfg *config.Config) images.Options {
+	return images.Options{
+		Widths:  cfg.ImageWidths,
+		Quality: cfg.ImageQuality,
+		Sizes:   cfg.ImageSizes,
+	}
+}
+
+// newGoldmark returns the Markdown of the site. Canvases and drawings that
+// notes embed are rendered with drawings; a nil drawings leaves them as
+// links.
+func newGoldmark(cfg *config.Config, contentDir string, routes *utils.Routes, drawings extensions.DrawingRenderer) goldmark.Markdown {
+	var rendererOptions []renderer.Option
+	if cfg.RawHTML == extensions.RawHTMLAllow {
+		rendererOptions = append(rendererOptions, html.WithUnsafe())
+	}
+
+	math := extensions.Katex
+	if cfg.MathRendering == extensions.MathML {
+		math = extensions.KatexMathML
+	}
+
+	ignore := func(relPath string) bool { return IsIgnored(cfg, relPath) }
+	resolver := extensions.NewSlugResolver(contentDir, routes, images.NewProcessor(ImageOptions(cfg)), ignore)
+	exts := []goldmark.Extender{
+		extension.GFM,
+		extension.Table,
+		extension.Strikethrough,
+		extension.TaskList,
+		extension.Footnote,
+		extensions.Comments,
+		extensions.ObsidianHighlight,
+		extensions.Mermaid,
+		math,
+		extensions.Wikilink(resolver),
+		extensions.Embeds(embedRegistry(cfg)),
+		extensions.Figures(cfg.ImageCaptions, cfg.ImageLightbox),
+		extensions.HeadingShift,
+		extensions.Anchor,
+		extensions.Callout,
+		extensions.Private,
+		extensions.RawHTML(cfg.RawHTML),
+		highlighting.NewHighlighting(
+			highlighting.WithFormatOptions(formatOptions...),
+			highlighting.WithGuessLanguage(true),
 		),
+		meta.Meta,
+	}
+	if files, ok := resolver.(extensions.FileResolver); ok {
+		exts = append(exts, extensions.DataTables(files))
+		if drawings != nil {
+			exts = append(exts, extensions.Drawings(files, drawings))
+		}
+	}
+
+	return goldmark.New(
+		goldmark.WithExtensions(exts...),
 		goldmark.WithParserOptions(
 			parser.WithAutoHeadingID(),
 		),
-		goldmark.WithRendererOptions(
-			html.WithUnsafe(),
-		),
+		goldmark.WithRendererOptions(rendererOptions...),
 	)
 }
 
+// embedRegistry returns the built-in embed providers and those of the
+// config, which are tried first so they can take over a built-in site.
+func embedRegistry(cfg *config.Config) *extensions.EmbedRegistry {
+	registry := extensions.NewEmbedRegistry()
+	for _, p := range cfg.EmbedProviders {
+		registry.Register(extensions.SchemeProvider(p.Name, p.Schemes, p.EmbedURL))
+	}
+	registry.Register(extensions.DefaultEmbedProviders...)
+	return registry
+}
+
 type Converter struct {
-	md goldmark.Markdown
+	md      goldmark.Markdown
+	slugger utils.Slugger
 }
 
-func NewConverter() *Converter {
-	return &Converter{md: newGoldmark()}
+func NewConverter(cfg *config.Config, contentDir string, routes *utils.Routes) *Converter {
+	return &Converter{
+		md:      newGoldmark(cfg, contentDir, routes, NewDrawings(cfg, contentDir, routes)),
+		slugger: routes.Slugger(),
+	}
 }
 
 func (c *Converter) ConvertWithContext(source []byte, ctx parser.Context) (string, error) {
@@ -62,3 +131,20 @@ func (c *Converter) ConvertWithContext(source []byte, ctx parser.Context) (strin
 	}
 	return buf.String(), nil
 }
+
+// convertPart converts a part of a page, such as a cell of a notebook, in a
+// context of its own so that its frontmatter stays apart. Its headings share
+// the ids of pc, and the scripts it needs are flagged in pc.
+func (c *Converter) convertPart(source []byte, pc parser.Context) (string, error) {
+	ctx := parser.NewContext(parser.WithIDs(pc.IDs()))
+	html, err := c.ConvertWithContext(source, ctx)
+	if err != nil {
+		return "", err
+	}
+	for _, f := range scriptFlags {
+		if v := ctx.Get(f.key); v != nil {
+			pc.Set(f.key, v)
+		}
+	}
+	return html, nil
+}
@@ -0,0 +1,207 @@
+package markdown
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"blaze/internal/canvas"
+	"blaze/internal/config"
+	"blaze/internal/excalidraw"
+	"blaze/internal/markdown/extensions"
+	"blaze/internal/utils"
+
+	"github.com/yuin/goldmark/parser"
+)
+
+// Drawings renders JSON Canvas files and Excalidraw drawings, as pages and
+// embedded in notes.
+type Drawings struct {
+	cfg        *config.Config
+	contentDir string
+	routes     *utils.Routes
+	folders    *FolderDefaults
+
+	// converter renders the text and notes of canvases. It does not embed
+	// drawings itself, so a canvas cannot end up inside itself.
+	once      sync.Once
+	converter *Converter
+}
+
+func NewDrawings(cfg *config.Config, contentDir string, routes *utils.Routes) *Drawings {
+	return &Drawings{
+		cfg:        cfg,
+		contentDir: contentDir,
+		routes:     routes,
+		folders:    NewFolderDefaults(contentDir),
+	}
+}
+
+func (d *Drawings) markdown() *Converter {
+	d.once.Do(func() {
+		d.converter = &Converter{
+			md:      newGoldmark(d.cfg, d.contentDir, d.routes, nil),
+			slugger: d.routes.Slugger(),
+		}
+	})
+	return d.converter
+}
+
+// RenderDrawing renders the canvas or Excalidraw drawing at path.
+func (d *Drawings) RenderDrawing(path, id string, pc parser.Context) (string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	if strings.HasSuffix(strings.ToLower(path), ".canvas") {
+		return d.canvas(content, id, pc)
+	}
+	return excalidrawSVG(content, id)
+}
+
+// canvas renders a canvas. The ids of the drawings in it start with id.
+func (d *Drawings) canvas(content []byte, id string, pc parser.Context) (string, error) {
+	c, err := canvas.Parse(content)
+	if err != nil {
+		return "", err
+	}
+	return canvas.Render(c, &canvasResolver{drawings: d, id: id, pc: pc}), nil
+}
+
+func excalidrawSVG(content []byte, id string) (string, error) {
+	drawing, err := excalidraw.Parse(content)
+	if err != nil {
+		return "", err
+	}
+	return drawing.SVG(id), nil
+}
+
+// render converts a note or the text of a canvas into the page of pc.
+func (d *Drawings) render(source []byte, pc parser.Context) string {
+	html, err := d.markdown().convertPart(source, pc)
+	if err != nil {
+		return ""
+	}
+	return html
+}
+
+// canvasResolver renders the nodes of a canvas.
+type canvasResolver struct {
+	drawings *Drawings
+	id       string
+	pc       parser.Context
+	files    int
+}
+
+func (r *canvasResolver) Markdown(text string) string {
+	return r.drawings.render([]byte(text), r.pc)
+}
+
+// File links to the page or file of a file node. Notes show their content,
+// unless they are protected by a password, and drawings are drawn. Notes
+// left out of the site are not shown at all.
+func (r *canvasResolver) File(file, subpath string) (string, string, bool) {
+	d := r.drawings
+	relPath := filepath.FromSlash(file)
+	url, ok := d.routes.URL(relPath)
+	if !ok {
+		return "", "", false
+	}
+	if !strings.EqualFold(filepath.Ext(relPath), ".md") {
+		if strings.EqualFold(filepath.Ext(relPath), ".excalidraw") {
+			return url, r.excalidraw(relPath), true
+		}
+		return url, "", true
+	}
+
+	content, err := os.ReadFile(filepath.Join(d.contentDir, relPath))
+	if err != nil {
+		return "", "", false
+	}
+	metadata, _ := ExtractFrontmatter(string(content))
+	if err := d.folders.Apply(relPath, metadata); err != nil || SkipReason(d.cfg, metadata) != "" {
+		return "", "", false
+	}
+
+	if heading := strings.TrimPrefix(subpath, "#"); heading != "" {
+		url += "#" + extensions.HeadingID(d.routes.Slugger(), heading)
+	}
+	if extensions.IsDrawing(relPath) {
+		return url, r.excalidraw(relPath), true
+	}
+	if _, ok := metadata["password"]; ok {
+		return url, "", true
+	}
+	if _, ok := metadata["passwordEnv"]; ok {
+		return url, "", true
+	}
+	return url, d.render(content, r.pc), true
+}
+
+func (r *canvasResolver) excalidraw(relPath string) string {
+	content, err := os.ReadFile(filepath.Join(r.drawings.contentDir, relPath))
+	if err != nil {
+		return ""
+	}
+	r.files++
+	svg, err := excalidrawSVG(content, fmt.Sprintf("%s-%d", r.id, r.files))
+	if err != nil {
+		return ""
+	}
+	return svg
+}
+
+// CanvasTransformer renders .canvas files as pages.
+type CanvasTransformer struct {
+	drawings *Drawings
+}
+
+func NewCanvasTransformer(cfg *config.Config, contentDir string, routes *utils.Routes) *CanvasTransformer {
+	return &CanvasTransformer{drawings: NewDrawings(cfg, contentDir, routes)}
+}
+
+func (t *CanvasTransformer) Name() string {
+	return "canvas"
+}
+
+// Transform renders the canvas. A canvas has no frontmatter, so its
+// metadata comes from the defaults of its folder.
+func (t *CanvasTransformer) Transform(content []byte) (string, map[string]string, error) {
+	ctx := parser.NewContext(parser.WithIDs(extensions.NewHeadingIDs(t.drawings.routes.Slugger())))
+	html, err := t.drawings.canvas(content, "canvas", ctx)
+	if err != nil {
+		return "", nil, err
+	}
+
+	metadata := make(map[string]string)
+	setScriptFlags(ctx, metadata)
+	return html, metadata, nil
+}
+
+// ExcalidrawTransformer renders Excalidraw drawings as pages, from
+// .excalidraw files and the .excalidraw.md notes of Obsidian's Excalidraw
+// plugin, whose frontmatter is the metadata of the page.
+type ExcalidrawTransformer struct{}
+
+func NewExcalidrawTransformer() *ExcalidrawTransformer {
+	return &ExcalidrawTransformer{}
+}
+
+func (t *ExcalidrawTransformer) Name() string {
+	return "excalidraw"
+}
+
+func (t *ExcalidrawTransformer) Transform(content []byte) (string, map[string]string, error) {
+	metadata := make(map[string]string)
+	if strings.HasPrefix(string(content), "---\n") {
+		metadata, _ = ExtractFrontmatter(string(content))
+	}
+
+	svg, err := excalidrawSVG(content, "drawing")
+	if err != nil {
+		return "", nil, err
+	}
+	return `<figure class="excalidraw-drawing">` + svg + "</figure>", metadata, nil
+}
@@ -0,0 +1,277 @@
+package extensions
+
+import (
+	"bytes"
+
+	"github.com/yuin/goldmark"
+	gast "github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+var commentDelimiter = []byte("%%")
+
+// CommentsKey holds the source segments of the comments of the document, in
+// order, for WithoutComments.
+var CommentsKey = parser.NewContextKey()
+
+// -----------------------------------------------------------------------------
+// Node Definition
+// -----------------------------------------------------------------------------
+
+// Comment is an Obsidian %% comment inside a paragraph.
+type Comment struct {
+	gast.BaseInline
+	// Segment is the comment in the source, delimiters included.
+	Segment text.Segment
+}
+
+var KindComment = gast.NewNodeKind("Comment")
+
+func (n *Comment) Kind() gast.NodeKind {
+	return KindComment
+}
+
+func (n *Comment) Dump(source []byte, level int) {
+	gast.DumpHelper(n, source, level, nil, nil)
+}
+
+// CommentBlock is an Obsidian %% comment that starts a line and may span
+// several lines.
+type CommentBlock struct {
+	gast.BaseBlock
+	// Segment is the comment in the source, from its opening delimiter to
+	// the end of its last line.
+	Segment text.Segment
+	closed  bool
+}
+
+var KindCommentBlock = gast.NewNodeKind("CommentBlock")
+
+func (n *CommentBlock) Kind() gast.NodeKind {
+	return KindCommentBlock
+}
+
+func (n *CommentBlock) IsRaw() bool {
+	return true
+}
+
+func (n *CommentBlock) Dump(source []byte, level int) {
+	gast.DumpHelper(n, source, level, nil, nil)
+}
+
+// -----------------------------------------------------------------------------
+// Block Parser
+// -----------------------------------------------------------------------------
+
+type commentBlockParser struct{}
+
+func (b *commentBlockParser) Trigger() []byte {
+	return []byte{'%'}
+}
+
+func (b *commentBlockParser) Open(parent gast.Node, reader text.Reader, pc parser.Context) (gast.Node, parser.State) {
+	line, segment := reader.PeekLine()
+	pos := pc.BlockOffset()
+	if pos < 0 || !bytes.HasPrefix(line[pos:], commentDelimiter) {
+		return nil, parser.NoChildren
+	}
+
+	node := &CommentBlock{Segment: text.NewSegment(segment.Start+pos, segment.Stop)}
+	rest := line[pos+len(commentDelimiter):]
+	if end := bytes.Index(rest, commentDelimiter); end >= 0 {
+		// A comment closed on its own line is a block; one followed by
+		// text is left to the inline parser.
+		if !util.IsBlank(rest[end+len(commentDelimiter):]) {
+			return nil, parser.NoChildren
+		}
+		node.closed = true
+	}
+
+	reader.AdvanceToEOL()
+	return node, parser.NoChildren
+}
+
+func (b *commentBlockParser) Continue(node gast.Node, reader text.Reader, pc parser.Context) parser.State {
+	comment := node.(*CommentBlock)
+	if comment.closed {
+		return parser.Close
+	}
+
+	// Like Obsidian, an unclosed comment runs to the end of the note.
+	line, segment := reader.PeekLine()
+	if bytes.Contains(line, commentDelimiter) {
+		comment.closed = true
+	}
+	comment.Segment.Stop = segment.Stop
+	reader.AdvanceToEOL()
+	return parser.Continue | parser.NoChildren
+}
+
+func (b *commentBlockParser) Close(node gast.Node, reader text.Reader, pc parser.Context) {}
+
+func (b *commentBlockParser) CanInterruptParagraph() bool {
+	return true
+}
+
+func (b *commentBlockParser) CanAcceptIndentedLine() bool {
+	return false
+}
+
+// -----------------------------------------------------------------------------
+// Inline Parser
+// -----------------------------------------------------------------------------
+
+type commentParser struct{}
+
+func (s *commentParser) Trigger() []byte {
+	return []byte{'%'}
+}
+
+func (s *commentParser) Parse(parent gast.Node, block text.Reader, pc parser.Context) gast.Node {
+	line, _ := block.PeekLine()
+	if !bytes.HasPrefix(line, commentDelimiter) {
+		return nil
+	}
+
+	l, pos := block.Position()
+	block.Advance(len(commentDelimiter))
+
+	for {
+		line, segment := block.PeekLine()
+		if line == nil {
+			break
+		}
+		if end := bytes.Index(line, commentDelimiter); end >= 0 {
+			block.Advance(end + len(commentDelimiter))
+			return &Comment{Segment: text.NewSegment(pos.Start, segment.Start+end+len(commentDelimiter))}
+		}
+		block.Advance(len(line))
+	}
+
+	// Unclosed %% inside a paragraph is plain text.
+	block.SetPosition(l, pos)
+	return nil
+}
+
+// -----------------------------------------------------------------------------
+// AST Transformer
+// -----------------------------------------------------------------------------
+
+// commentTransformer drops comments from the document right after parsing,
+// so renderers and anything else reading the AST never see their text.
+type commentTransformer struct{}
+
+func (t *commentTransformer) Transform(doc *gast.Document, reader text.Reader, pc parser.Context) {
+	var comments []gast.Node
+	var segments []text.Segment
+	_ = gast.Walk(doc, func(n gast.Node, entering bool) (gast.WalkStatus, error) {
+		if !entering {
+			return gast.WalkContinue, nil
+		}
+		switch node := n.(type) {
+		case *Comment:
+			segments = append(segments, node.Segment)
+		case *CommentBlock:
+			segments = append(segments, node.Segment)
+		default:
+			return gast.WalkContinue, nil
+		}
+		comments = append(comments, n)
+		return gast.WalkSkipChildren, nil
+	})
+	if len(segments) > 0 {
+		pc.Set(CommentsKey, segments)
+	}
+
+	source := reader.Source()
+	for _, n := range comments {
+		parent := n.Parent()
+		if parent == nil {
+			continue
+		}
+		if prev, ok := n.PreviousSibling().(*gast.Text); ok && n.NextSibling() == nil {
+			prev.Segment = prev.Segment.TrimRightSpace(source)
+		}
+		parent.RemoveChild(parent, n)
+		if parent.Kind() == gast.KindParagraph && isBlankParagraph(parent, source) && parent.Parent() != nil {
+			parent.Parent().RemoveChild(parent.Parent(), parent)
+		}
+	}
+}
+
+// isBlankParagraph reports whether a paragraph is left with only whitespace
+// once its comments are removed.
+func isBlankParagraph(n gast.Node, source []byte) bool {
+	for c := n.FirstChild(); c != nil; c = c.NextSibling() {
+		t, ok := c.(*gast.Text)
+		if !ok || !util.IsBlank(t.Segment.Value(source)) {
+			return false
+		}
+	}
+	return true
+}
+
+// StripComments removes %% comments that open and close within value. Heading
+// ids are generated from the raw heading line, before inline parsing, and go
+// through it so a comment never shows up in an id.
+func StripComments(value []byte) []byte {
+	for {
+		start := bytes.Index(value, commentDelimiter)
+		if start < 0 {
+			return value
+		}
+		end := bytes.Index(value[start+len(commentDelimiter):], commentDelimiter)
+		if end < 0 {
+			return value
+		}
+		end += start + 2*len(commentDelimiter)
+		value = append(value[:start:start], value[end:]...)
+	}
+}
+
+// WithoutComments returns the source of a parsed document with its comments
+// cut out, for uses of the Markdown itself, such as search, that must not
+// publish them either.
+func WithoutComments(source []byte, pc parser.Context) []byte {
+	segments, _ := pc.Get(CommentsKey).([]text.Segment)
+	if len(segments) == 0 {
+		return source
+	}
+
+	result := make([]byte, 0, len(source))
+	last := 0
+	for _, segment := range segments {
+		if segment.Start < last {
+			continue
+		}
+		result = append(result, source[last:segment.Start]...)
+		last = segment.Stop
+	}
+	return append(result, source[last:]...)
+}
+
+// -----------------------------------------------------------------------------
+// Extension
+// -----------------------------------------------------------------------------
+
+type comment struct{}
+
+// Comments removes Obsidian %% comments, inline or spanning several lines,
+// from the output.
+var Comments = &comment{}
+
+func (e *comment) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(
+		parser.WithBlockParsers(
+			util.Prioritized(&commentBlockParser{}, 90),
+		),
+		parser.WithInlineParsers(
+			util.Prioritized(&commentParser{}, 90),
+		),
+		parser.WithASTTransformers(
+			util.Prioritized(&commentTransformer{}, 0),
+		),
+	)
+}
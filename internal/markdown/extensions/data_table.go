@@ -0,0 +1,299 @@
+package extensions
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"blaze/internal/datatable"
+
+	"github.com/yuin/goldmark"
+	gast "github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// dataComma returns the separator of the values in a data file or fenced
+// code block of the given name or language, or 0 if it holds no data.
+func dataComma(name string) rune {
+	name = strings.ToLower(name)
+	switch {
+	case name == "csv" || filepath.Ext(name) == ".csv":
+		return ','
+	case name == "tsv" || filepath.Ext(name) == ".tsv":
+		return '\t'
+	}
+	return 0
+}
+
+// -----------------------------------------------------------------------------
+// Node Definition
+// -----------------------------------------------------------------------------
+
+// DataTable is CSV or TSV data rendered as a table.
+type DataTable struct {
+	gast.BaseBlock
+	HTML string
+}
+
+var KindDataTable = gast.NewNodeKind("DataTable")
+
+func (n *DataTable) Kind() gast.NodeKind {
+	return KindDataTable
+}
+
+func (n *DataTable) Dump(source []byte, level int) {
+	gast.DumpHelper(n, source, level, nil, nil)
+}
+
+// -----------------------------------------------------------------------------
+// AST Transformer
+// -----------------------------------------------------------------------------
+
+// dataTableTransformer renders CSV and TSV data as tables: a file embedded
+// by ![[data.csv]] alone in a paragraph, with options after #, or a csv or
+// tsv fenced code block, with options in its attributes:
+//
+//	![[data.csv#columns=name,price&sort=-price&limit=10]]
+//
+//	```csv {header=false limit=5}
+//	Apple,3
+//	```
+type dataTableTransformer struct {
+	files FileResolver
+}
+
+func (t *dataTableTransformer) Transform(doc *gast.Document, reader text.Reader, pc parser.Context) {
+	source := reader.Source()
+
+	var replacements [][2]gast.Node
+	var errs []string
+	_ = gast.Walk(doc, func(n gast.Node, entering bool) (gast.WalkStatus, error) {
+		if !entering {
+			return gast.WalkContinue, nil
+		}
+
+		var table *datatable.Table
+		var options tableOptions
+		var err error
+		switch node := n.(type) {
+		case *gast.Paragraph:
+			link := soleEmbed(node, source)
+			if link == nil || dataComma(string(link.Target)) == 0 {
+				return gast.WalkSkipChildren, nil
+			}
+			table, err = t.readFile(string(link.Target))
+			if err == nil {
+				options, err = parseFragmentOptions(string(link.Fragment))
+			}
+			if err != nil {
+				err = fmt.Errorf("%s: %w", link.Target, err)
+			}
+		case *gast.FencedCodeBlock:
+			comma := dataComma(string(node.Language(source)))
+			if comma == 0 {
+				return gast.WalkSkipChildren, nil
+			}
+			table, err = datatable.Parse(node.Lines().Value(source), comma)
+			if err == nil {
+				options, err = parseInfoOptions(node, source)
+			}
+			if err != nil {
+				err = fmt.Errorf("%s block: %w", node.Language(source), err)
+			}
+		default:
+			return gast.WalkContinue, nil
+		}
+
+		if err == nil {
+			err = options.apply(table)
+		}
+		if err != nil {
+			errs = append(errs, err.Error())
+			return gast.WalkSkipChildren, nil
+		}
+		replacements = append(replacements, [2]gast.Node{n, &DataTable{HTML: table.HTML(false)}})
+		return gast.WalkSkipChildren, nil
+	})
+
+	for _, r := range replacements {
+		r[0].Parent().ReplaceChild(r[0].Parent(), r[0], r[1])
+	}
+	reportIncludeErrors(pc, errs)
+}
+
+func (t *dataTableTransformer) readFile(target string) (*datatable.Table, error) {
+	path, ok := t.files.ResolveFile(target)
+	if !ok {
+		return nil, fmt.Errorf("not found")
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return datatable.Parse(content, dataComma(target))
+}
+
+// -----------------------------------------------------------------------------
+// Table Options
+// -----------------------------------------------------------------------------
+
+// tableOptions is how to show the data of a table.
+type tableOptions struct {
+	// noHeader shows the first row as data.
+	noHeader bool
+	// columns are the columns to show, by header or number.
+	columns []string
+	// sort is the column to sort by, descending with a leading -.
+	sort string
+	// limit is the most rows to show, or 0 for all.
+	limit int
+}
+
+// parseFragmentOptions reads the options of an embed, such as
+// columns=name,price&sort=-price.
+func parseFragmentOptions(fragment string) (tableOptions, error) {
+	var options tableOptions
+	for _, option := range strings.Split(fragment, "&") {
+		if strings.TrimSpace(option) == "" {
+			continue
+		}
+		key, value, _ := strings.Cut(option, "=")
+		if err := options.set(key, value); err != nil {
+			return options, err
+		}
+	}
+	return options, nil
+}
+
+// parseInfoOptions reads the options of a fenced code block from the
+// attributes in its info string, such as {columns="name,price" limit=5}.
+func parseInfoOptions(block *gast.FencedCodeBlock, source []byte) (tableOptions, error) {
+	var options tableOptions
+	if block.Info == nil {
+		return options, nil
+	}
+	info := block.Info.Segment.Value(source)
+	i := strings.IndexByte(string(info), '{')
+	if i < 0 {
+		return options, nil
+	}
+	attrs, ok := parser.ParseAttributes(text.NewReader(info[i:]))
+	if !ok {
+		return options, fmt.Errorf("invalid options %s", info[i:])
+	}
+	for _, attr := range attrs {
+		if err := options.set(string(attr.Name), attributeString(attr.Value)); err != nil {
+			return options, err
+		}
+	}
+	return options, nil
+}
+
+// attributeString returns an attribute value as text. Lists, as in
+// columns=["name", "price"], are joined with commas.
+func attributeString(value interface{}) string {
+	switch v := value.(type) {
+	case []byte:
+		return string(v)
+	case []interface{}:
+		parts := make([]string, len(v))
+		for i, item := range v {
+			parts[i] = attributeString(item)
+		}
+		return strings.Join(parts, ",")
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func (o *tableOptions) set(key, value string) error {
+	value = strings.TrimSpace(value)
+	switch strings.ToLower(strings.TrimSpace(key)) {
+	case "header":
+		header, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid header %q", value)
+		}
+		o.noHeader = !header
+	case "columns":
+		o.columns = strings.Split(value, ",")
+	case "sort":
+		o.sort = value
+	case "limit":
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 0 {
+			return fmt.Errorf("invalid limit %q", value)
+		}
+		o.limit = limit
+	default:
+		return fmt.Errorf("unknown option %q", key)
+	}
+	return nil
+}
+
+// apply sorts before selecting the columns, so a table can be sorted by a
+// column it does not show.
+func (o tableOptions) apply(t *datatable.Table) error {
+	if o.noHeader {
+		t.NoHeader()
+	}
+	if o.sort != "" {
+		if err := t.Sort(strings.TrimPrefix(o.sort, "-"), strings.HasPrefix(o.sort, "-")); err != nil {
+			return err
+		}
+	}
+	if len(o.columns) > 0 {
+		if err := t.SelectColumns(o.columns); err != nil {
+			return err
+		}
+	}
+	if o.limit > 0 {
+		t.Truncate(o.limit)
+	}
+	return nil
+}
+
+// -----------------------------------------------------------------------------
+// HTML Renderer
+// -----------------------------------------------------------------------------
+
+type dataTableRenderer struct{}
+
+func (r *dataTableRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(KindDataTable, r.renderDataTable)
+}
+
+func (r *dataTableRenderer) renderDataTable(w util.BufWriter, source []byte, node gast.Node, entering bool) (gast.WalkStatus, error) {
+	if entering {
+		_, _ = w.WriteString(node.(*DataTable).HTML)
+	}
+	return gast.WalkSkipChildren, nil
+}
+
+// -----------------------------------------------------------------------------
+// Extension
+// -----------------------------------------------------------------------------
+
+type dataTables struct {
+	files FileResolver
+}
+
+// DataTables renders CSV and TSV data embedded in notes as tables, in the
+// markup of Markdown tables, finding the files with files.
+func DataTables(files FileResolver) goldmark.Extender {
+	return &dataTables{files: files}
+}
+
+func (e *dataTables) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(parser.WithASTTransformers(
+		util.Prioritized(&dataTableTransformer{files: e.files}, 115),
+	))
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(
+		util.Prioritized(&dataTableRenderer{}, 500),
+	))
+}
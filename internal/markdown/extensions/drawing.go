@@ -0,0 +1,149 @@
+package extensions
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	gast "github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// DrawingRenderer renders the canvases and Excalidraw drawings embedded in
+// notes.
+type DrawingRenderer interface {
+	// RenderDrawing returns the HTML of the drawing in the file at path.
+	// id is unique in the page, for the ids the HTML defines. Scripts the
+	// drawing needs are flagged in pc, as for the rest of the page.
+	RenderDrawing(path, id string, pc parser.Context) (string, error)
+}
+
+// IsDrawing reports whether name is a JSON Canvas file or an Excalidraw
+// drawing, as an .excalidraw file or an .excalidraw.md note.
+func IsDrawing(name string) bool {
+	name = strings.ToLower(name)
+	return strings.HasSuffix(name, ".canvas") ||
+		strings.HasSuffix(name, ".excalidraw") ||
+		strings.HasSuffix(name, ".excalidraw.md")
+}
+
+// -----------------------------------------------------------------------------
+// Node Definition
+// -----------------------------------------------------------------------------
+
+// Drawing is a canvas or Excalidraw drawing embedded alone in its paragraph.
+type Drawing struct {
+	gast.BaseBlock
+	Target []byte
+	HTML   string
+}
+
+var KindDrawing = gast.NewNodeKind("Drawing")
+
+func (n *Drawing) Kind() gast.NodeKind {
+	return KindDrawing
+}
+
+func (n *Drawing) Dump(source []byte, level int) {
+	gast.DumpHelper(n, source, level, map[string]string{"Target": string(n.Target)}, nil)
+}
+
+// -----------------------------------------------------------------------------
+// AST Transformer
+// -----------------------------------------------------------------------------
+
+// drawingTransformer replaces ![[board.canvas]] and ![[sketch.excalidraw]]
+// alone in a paragraph with the rendered drawing.
+type drawingTransformer struct {
+	files    FileResolver
+	drawings DrawingRenderer
+}
+
+func (t *drawingTransformer) Transform(doc *gast.Document, reader text.Reader, pc parser.Context) {
+	source := reader.Source()
+
+	var replacements [][2]gast.Node
+	var errs []string
+	_ = gast.Walk(doc, func(n gast.Node, entering bool) (gast.WalkStatus, error) {
+		if !entering {
+			return gast.WalkContinue, nil
+		}
+		p, ok := n.(*gast.Paragraph)
+		if !ok {
+			return gast.WalkContinue, nil
+		}
+
+		link := soleEmbed(p, source)
+		if link == nil || !IsDrawing(string(link.Target)) {
+			return gast.WalkSkipChildren, nil
+		}
+
+		target := string(link.Target)
+		path, ok := t.files.ResolveFile(target)
+		if !ok {
+			errs = append(errs, fmt.Sprintf("%s: not found", target))
+			return gast.WalkSkipChildren, nil
+		}
+		html, err := t.drawings.RenderDrawing(path, fmt.Sprintf("drawing-%d", len(replacements)+1), pc)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", target, err))
+			return gast.WalkSkipChildren, nil
+		}
+
+		replacements = append(replacements, [2]gast.Node{p, &Drawing{Target: link.Target, HTML: html}})
+		return gast.WalkSkipChildren, nil
+	})
+
+	for _, r := range replacements {
+		r[0].Parent().ReplaceChild(r[0].Parent(), r[0], r[1])
+	}
+	reportIncludeErrors(pc, errs)
+}
+
+// -----------------------------------------------------------------------------
+// HTML Renderer
+// -----------------------------------------------------------------------------
+
+type drawingRenderer struct{}
+
+func (r *drawingRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(KindDrawing, r.renderDrawing)
+}
+
+func (r *drawingRenderer) renderDrawing(w util.BufWriter, source []byte, node gast.Node, entering bool) (gast.WalkStatus, error) {
+	if !entering {
+		return gast.WalkContinue, nil
+	}
+	n := node.(*Drawing)
+	_, _ = w.WriteString(`<div class="drawing-embed">`)
+	_, _ = w.WriteString(n.HTML)
+	_, _ = w.WriteString("</div>\n")
+	return gast.WalkSkipChildren, nil
+}
+
+// -----------------------------------------------------------------------------
+// Extension
+// -----------------------------------------------------------------------------
+
+type drawings struct {
+	files    FileResolver
+	drawings DrawingRenderer
+}
+
+// Drawings renders the canvases and Excalidraw drawings embedded in notes
+// with renderer, finding their files with files.
+func Drawings(files FileResolver, renderer DrawingRenderer) goldmark.Extender {
+	return &drawings{files: files, drawings: renderer}
+}
+
+func (e *drawings) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(parser.WithASTTransformers(
+		util.Prioritized(&drawingTransformer{files: e.files, drawings: e.drawings}, 120),
+	))
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(
+		util.Prioritized(&drawingRenderer{}, 500),
+	))
+}
@@ -0,0 +1,419 @@
+package extensions
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	gast "github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// EmbedContextKey is set when a page embeds a player, which needs the
+// embed script.
+var EmbedContextKey = parser.NewContextKey()
+
+// Embed is the player of an external page, such as a video.
+type Embed struct {
+	// Provider names the site, such as "YouTube".
+	Provider string
+	// URL is the link to the page, opened when scripts are off.
+	URL string
+	// Src is the address of the player, loaded in an iframe on click.
+	Src string
+	// Thumbnail is a preview image, if the provider has one.
+	Thumbnail string
+}
+
+// EmbedProvider turns links to the pages of a site into players.
+type EmbedProvider interface {
+	// Embed returns the player of the page at u, reporting whether u is a
+	// page of the provider.
+	Embed(u *url.URL) (Embed, bool)
+}
+
+// EmbedRegistry is the list of providers image links are matched against.
+type EmbedRegistry struct {
+	providers []EmbedProvider
+}
+
+// NewEmbedRegistry returns a registry of providers, tried in order.
+func NewEmbedRegistry(providers ...EmbedProvider) *EmbedRegistry {
+	return &EmbedRegistry{providers: providers}
+}
+
+// DefaultEmbedProviders are the built-in providers.
+var DefaultEmbedProviders = []EmbedProvider{YouTube, Vimeo, Loom}
+
+// Register adds providers, tried after those already registered.
+func (r *EmbedRegistry) Register(providers ...EmbedProvider) {
+	r.providers = append(r.providers, providers...)
+}
+
+// Match returns the player of the first provider that knows link.
+func (r *EmbedRegistry) Match(link string) (Embed, bool) {
+	u, err := url.Parse(link)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return Embed{}, false
+	}
+	for _, p := range r.providers {
+		if embed, ok := p.Embed(u); ok {
+			if embed.URL == "" {
+				embed.URL = link
+			}
+			return embed, true
+		}
+	}
+	return Embed{}, false
+}
+
+// -----------------------------------------------------------------------------
+// Providers
+// -----------------------------------------------------------------------------
+
+var reVideoID = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// hostIs reports whether u is on one of hosts, with or without www.
+func hostIs(u *url.URL, hosts ...string) bool {
+	host := strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+	for _, h := range hosts {
+		if host == h {
+			return true
+		}
+	}
+	return false
+}
+
+// pathSegments splits the path of u, without empty segments.
+func pathSegments(u *url.URL) []string {
+	return strings.FieldsFunc(u.Path, func(r rune) bool { return r == '/' })
+}
+
+// reTimestamp matches a time such as 90, 90s, 1m30s or 1h2m3s.
+var reTimestamp = regexp.MustCompile(`^(?:(\d+)h)?(?:(\d+)m)?(?:(\d+)s?)?$`)
+
+// seconds parses a timestamp, returning 0 when there is none.
+func seconds(t string) int {
+	m := reTimestamp.FindStringSubmatch(t)
+	if m == nil {
+		return 0
+	}
+	total := 0
+	for i, unit := range []int{3600, 60, 1} {
+		n, _ := strconv.Atoi(m[i+1])
+		total += n * unit
+	}
+	return total
+}
+
+// startTime returns the start time of a link, given by t= or start= in its
+// query or #t= in its fragment.
+func startTime(u *url.URL) int {
+	q := u.Query()
+	for _, key := range []string{"t", "start"} {
+		if v := q.Get(key); v != "" {
+			return seconds(v)
+		}
+	}
+	if t, ok := strings.CutPrefix(u.Fragment, "t="); ok {
+		return seconds(t)
+	}
+	return 0
+}
+
+type youtubeProvider struct{}
+
+// YouTube embeds videos, Shorts, live streams and playlists, starting at
+// the time of the link, from the privacy-enhanced youtube-nocookie.com.
+var YouTube EmbedProvider = youtubeProvider{}
+
+func (youtubeProvider) Embed(u *url.URL) (Embed, bool) {
+	segments := pathSegments(u)
+	list := u.Query().Get("list")
+
+	var id string
+	switch {
+	case hostIs(u, "youtu.be"):
+		if len(segments) == 1 {
+			id = segments[0]
+		}
+	case hostIs(u, "youtube.com", "m.youtube.com", "music.youtube.com", "youtube-nocookie.com"):
+		switch {
+		case len(segments) == 1 && segments[0] == "watch":
+			id = u.Query().Get("v")
+		case len(segments) == 1 && segments[0] == "playlist":
+		case len(segments) == 2 && (segments[0] == "embed" || segments[0] == "shorts" ||
+			segments[0] == "live" || segments[0] == "v"):
+			id = segments[1]
+		default:
+			return Embed{}, false
+		}
+	default:
+		return Embed{}, false
+	}
+
+	if id == "videoseries" {
+		id = ""
+	}
+	if (id == "" && list == "") || (id != "" && !reVideoID.MatchString(id)) {
+		return Embed{}, false
+	}
+
+	params := url.Values{}
+	if list != "" {
+		params.Set("list", list)
+	}
+	if start := startTime(u); start > 0 {
+		params.Set("start", strconv.Itoa(start))
+	}
+
+	embed := Embed{Provider: "YouTube"}
+	if id == "" {
+		embed.Src = "https://www.youtube-nocookie.com/embed/videoseries"
+	} else {
+		embed.Src = "https://www.youtube-nocookie.com/embed/" + id
+		embed.Thumbnail = "https://i.ytimg.com/vi/" + id + "/hqdefault.jpg"
+	}
+	if len(params) > 0 {
+		embed.Src += "?" + params.Encode()
+	}
+	return embed, true
+}
+
+type vimeoProvider struct{}
+
+// Vimeo embeds videos, including unlisted ones, whose link has a hash, and
+// asks the player not to track viewers.
+var Vimeo EmbedProvider = vimeoProvider{}
+
+func (vimeoProvider) Embed(u *url.URL) (Embed, bool) {
+	segments := pathSegments(u)
+
+	var id, hash string
+	switch {
+	case hostIs(u, "player.vimeo.com"):
+		if len(segments) != 2 || segments[0] != "video" {
+			return Embed{}, false
+		}
+		id = segments[1]
+	case hostIs(u, "vimeo.com"):
+		// vimeo.com/ID, vimeo.com/ID/HASH, and videos of channels and
+		// groups, such as vimeo.com/channels/staffpicks/ID.
+		for i, s := range segments {
+			if _, err := strconv.Atoi(s); err == nil {
+				id = s
+				if i+1 < len(segments) {
+					hash = segments[i+1]
+				}
+				break
+			}
+		}
+	default:
+		return Embed{}, false
+	}
+	if _, err := strconv.Atoi(id); err != nil {
+		return Embed{}, false
+	}
+
+	params := url.Values{"dnt": {"1"}}
+	if h := u.Query().Get("h"); h != "" {
+		hash = h
+	}
+	if hash != "" && reVideoID.MatchString(hash) {
+		params.Set("h", hash)
+	}
+
+	src := "https://player.vimeo.com/video/" + id + "?" + params.Encode()
+	if start := startTime(u); start > 0 {
+		src += "#t=" + strconv.Itoa(start) + "s"
+	}
+	return Embed{Provider: "Vimeo", Src: src}, true
+}
+
+type loomProvider struct{}
+
+// Loom embeds shared screen recordings.
+var Loom EmbedProvider = loomProvider{}
+
+func (loomProvider) Embed(u *url.URL) (Embed, bool) {
+	segments := pathSegments(u)
+	if !hostIs(u, "loom.com") || len(segments) != 2 ||
+		(segments[0] != "share" && segments[0] != "embed") || !reVideoID.MatchString(segments[1]) {
+		return Embed{}, false
+	}
+
+	src := "https://www.loom.com/embed/" + segments[1]
+	if start := startTime(u); start > 0 {
+		src += "?t=" + strconv.Itoa(start)
+	}
+	return Embed{Provider: "Loom", Src: src}, true
+}
+
+// schemeProvider embeds the links matching URL schemes, as listed by
+// oEmbed providers.
+type schemeProvider struct {
+	name     string
+	schemes  []*regexp.Regexp
+	embedURL string
+}
+
+// SchemeProvider returns a provider for the links matching one of schemes,
+// in which * stands for any text, such as "https://example.com/v/*". Its
+// player is embedURL, in which {url} is replaced by the escaped link and
+// {1}, {2}… by the text matched by each *.
+func SchemeProvider(name string, schemes []string, embedURL string) EmbedProvider {
+	p := &schemeProvider{name: name, embedURL: embedURL}
+	for _, scheme := range schemes {
+		parts := strings.Split(scheme, "*")
+		for i, part := range parts {
+			parts[i] = regexp.QuoteMeta(part)
+		}
+		p.schemes = append(p.schemes, regexp.MustCompile("^"+strings.Join(parts, "(.*?)")+"$"))
+	}
+	return p
+}
+
+func (p *schemeProvider) Embed(u *url.URL) (Embed, bool) {
+	link := u.String()
+	for _, scheme := range p.schemes {
+		m := scheme.FindStringSubmatch(link)
+		if m == nil {
+			continue
+		}
+		replacements := []string{"{url}", url.QueryEscape(link)}
+		for i, part := range m[1:] {
+			replacements = append(replacements, "{"+strconv.Itoa(i+1)+"}", part)
+		}
+		src := strings.NewReplacer(replacements...).Replace(p.embedURL)
+		return Embed{Provider: p.name, Src: src}, true
+	}
+	return Embed{}, false
+}
+
+// -----------------------------------------------------------------------------
+// Node Definition
+// -----------------------------------------------------------------------------
+
+// EmbedNode is an image link to a page a provider embeds.
+type EmbedNode struct {
+	gast.BaseInline
+	Embed
+	// Title is the alt text of the image.
+	Title string
+}
+
+var KindEmbed = gast.NewNodeKind("Embed")
+
+func (n *EmbedNode) Kind() gast.NodeKind {
+	return KindEmbed
+}
+
+func (n *EmbedNode) Dump(source []byte, level int) {
+	gast.DumpHelper(n, source, level, map[string]string{"Src": n.Src}, nil)
+}
+
+// -----------------------------------------------------------------------------
+// AST Transformer
+// -----------------------------------------------------------------------------
+
+// embedTransformer replaces images whose link is a page of a provider, such
+// as ![Talk](https://www.youtube.com/watch?v=ID&t=90), with its player.
+type embedTransformer struct {
+	registry *EmbedRegistry
+}
+
+func (t *embedTransformer) Transform(doc *gast.Document, reader text.Reader, pc parser.Context) {
+	source := reader.Source()
+
+	var replacements [][2]gast.Node
+	_ = gast.Walk(doc, func(n gast.Node, entering bool) (gast.WalkStatus, error) {
+		if !entering {
+			return gast.WalkContinue, nil
+		}
+		img, ok := n.(*gast.Image)
+		if !ok {
+			return gast.WalkContinue, nil
+		}
+		embed, ok := t.registry.Match(string(img.Destination))
+		if !ok {
+			return gast.WalkSkipChildren, nil
+		}
+		node := &EmbedNode{Embed: embed, Title: string(img.Text(source))}
+		replacements = append(replacements, [2]gast.Node{img, node})
+		return gast.WalkSkipChildren, nil
+	})
+
+	for _, r := range replacements {
+		r[0].Parent().ReplaceChild(r[0].Parent(), r[0], r[1])
+	}
+	if len(replacements) > 0 {
+		pc.Set(EmbedContextKey, true)
+	}
+}
+
+// -----------------------------------------------------------------------------
+// HTML Renderer
+// -----------------------------------------------------------------------------
+
+// embedRenderer writes a facade for each player: a link to the page with
+// the thumbnail, which the embed script swaps for the player iframe when
+// clicked, so that pages don't load players that are never played.
+type embedRenderer struct{}
+
+func (r *embedRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(KindEmbed, r.renderEmbed)
+}
+
+func (r *embedRenderer) renderEmbed(w util.BufWriter, source []byte, node gast.Node, entering bool) (gast.WalkStatus, error) {
+	if !entering {
+		return gast.WalkContinue, nil
+	}
+	n := node.(*EmbedNode)
+
+	title := n.Title
+	if title == "" {
+		title = n.Provider
+	}
+	escape := func(s string) string { return string(util.EscapeHTML([]byte(s))) }
+
+	// Only phrasing content, so that the facade may sit inside a paragraph.
+	fmt.Fprintf(w, `<span class="embed embed-%s" data-embed-src="%s" data-embed-title="%s">`,
+		escape(strings.ToLower(strings.ReplaceAll(n.Provider, " ", "-"))), escape(n.Src), escape(title))
+	fmt.Fprintf(w, `<a class="embed-facade" href="%s" aria-label="Play: %s">`, escape(n.URL), escape(title))
+	if n.Thumbnail != "" {
+		fmt.Fprintf(w, `<img src="%s" alt="" loading="lazy" decoding="async" />`, escape(n.Thumbnail))
+	}
+	_, _ = w.WriteString(`<span class="embed-play" aria-hidden="true"></span>`)
+	fmt.Fprintf(w, `<span class="embed-title">%s</span>`, escape(title))
+	_, _ = w.WriteString(`</a></span>`)
+	return gast.WalkSkipChildren, nil
+}
+
+// -----------------------------------------------------------------------------
+// Extension
+// -----------------------------------------------------------------------------
+
+type embeds struct {
+	registry *EmbedRegistry
+}
+
+// Embeds renders image links to the pages of the providers of registry as
+// players.
+func Embeds(registry *EmbedRegistry) goldmark.Extender {
+	return &embeds{registry: registry}
+}
+
+func (e *embeds) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(parser.WithASTTransformers(
+		util.Prioritized(&embedTransformer{registry: e.registry}, 500),
+	))
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(
+		util.Prioritized(&embedRenderer{}, 500),
+	))
+}
@@ -0,0 +1,164 @@
+package extensions
+
+import (
+	"github.com/yuin/goldmark"
+	gast "github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// Image caption sources, selected by the imageCaptions config option.
+const (
+	// CaptionAlt captions images with their alternative text.
+	CaptionAlt = "alt"
+	// CaptionTitle captions images with their title, as in
+	// ![Alt](photo.jpg "Caption").
+	CaptionTitle = "title"
+	// CaptionNone leaves images without a caption.
+	CaptionNone = "none"
+)
+
+// LightboxContextKey is set when a page has images that open in the
+// lightbox, which needs the lightbox script.
+var LightboxContextKey = parser.NewContextKey()
+
+// -----------------------------------------------------------------------------
+// Node Definition
+// -----------------------------------------------------------------------------
+
+// Figure is an image alone in its paragraph, with its caption.
+type Figure struct {
+	gast.BaseBlock
+	Caption  []byte
+	Lightbox bool
+}
+
+var KindFigure = gast.NewNodeKind("Figure")
+
+func (n *Figure) Kind() gast.NodeKind {
+	return KindFigure
+}
+
+func (n *Figure) Dump(source []byte, level int) {
+	gast.DumpHelper(n, source, level, map[string]string{"Caption": string(n.Caption)}, nil)
+}
+
+// -----------------------------------------------------------------------------
+// AST Transformer
+// -----------------------------------------------------------------------------
+
+// figureTransformer turns paragraphs holding only an image, written as
+// ![Alt](photo.jpg) or ![[photo.jpg|Alt]], into figures.
+type figureTransformer struct {
+	caption  string
+	lightbox bool
+}
+
+func (t *figureTransformer) Transform(doc *gast.Document, reader text.Reader, pc parser.Context) {
+	source := reader.Source()
+
+	var paragraphs []*gast.Paragraph
+	var figures []*Figure
+	_ = gast.Walk(doc, func(n gast.Node, entering bool) (gast.WalkStatus, error) {
+		if !entering {
+			return gast.WalkContinue, nil
+		}
+		p, ok := n.(*gast.Paragraph)
+		if !ok {
+			return gast.WalkContinue, nil
+		}
+
+		var caption []byte
+		switch img := soleInline(p, source).(type) {
+		case *gast.Image:
+			switch t.caption {
+			case CaptionAlt:
+				caption = nodeText(source, img)
+			case CaptionTitle:
+				caption = img.Title
+			}
+		case *WikilinkNode:
+			if !img.Embed || mediaKind(string(img.Target)) != mediaImage {
+				return gast.WalkSkipChildren, nil
+			}
+			// Wikilinks have no title: their label is the alternative text.
+			if t.caption == CaptionAlt {
+				caption, _, _ = embedLabel(img, source)
+			}
+		default:
+			return gast.WalkSkipChildren, nil
+		}
+
+		paragraphs = append(paragraphs, p)
+		figures = append(figures, &Figure{Caption: caption, Lightbox: t.lightbox})
+		return gast.WalkSkipChildren, nil
+	})
+
+	for i, p := range paragraphs {
+		figure := figures[i]
+		image := soleInline(p, source)
+		p.Parent().ReplaceChild(p.Parent(), p, figure)
+		figure.AppendChild(figure, image)
+	}
+	if t.lightbox && len(figures) > 0 {
+		pc.Set(LightboxContextKey, true)
+	}
+}
+
+// -----------------------------------------------------------------------------
+// HTML Renderer
+// -----------------------------------------------------------------------------
+
+type figureRenderer struct{}
+
+func (r *figureRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(KindFigure, r.renderFigure)
+}
+
+func (r *figureRenderer) renderFigure(w util.BufWriter, source []byte, node gast.Node, entering bool) (gast.WalkStatus, error) {
+	n := node.(*Figure)
+	if entering {
+		if n.Lightbox {
+			_, _ = w.WriteString(`<figure class="figure lightbox">`)
+		} else {
+			_, _ = w.WriteString(`<figure class="figure">`)
+		}
+		return gast.WalkContinue, nil
+	}
+
+	if len(n.Caption) > 0 {
+		_, _ = w.WriteString("<figcaption>")
+		_, _ = w.Write(util.EscapeHTML(n.Caption))
+		_, _ = w.WriteString("</figcaption>")
+	}
+	_, _ = w.WriteString("</figure>\n")
+	return gast.WalkContinue, nil
+}
+
+// -----------------------------------------------------------------------------
+// Extension
+// -----------------------------------------------------------------------------
+
+type figures struct {
+	caption  string
+	lightbox bool
+}
+
+// Figures renders images alone in their paragraph as figures, captioned
+// from the source caption names, and opening in a lightbox when clicked if
+// lightbox is set.
+func Figures(caption string, lightbox bool) goldmark.Extender {
+	return &figures{caption: caption, lightbox: lightbox}
+}
+
+func (e *figures) Extend(m goldmark.Markdown) {
+	// After the embeds, so that links to videos are not taken for images.
+	m.Parser().AddOptions(parser.WithASTTransformers(
+		util.Prioritized(&figureTransformer{caption: e.caption, lightbox: e.lightbox}, 600),
+	))
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(
+		util.Prioritized(&figureRenderer{}, 500),
+	))
+}
@@ -0,0 +1,99 @@
+package extensions
+
+import (
+	"fmt"
+
+	"blaze/internal/utils"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+)
+
+// HeadingID returns the id of a heading with the given text, before
+// duplicates are numbered. Heading ids, anchors and the fragments of
+// [[Note#Heading]] links all go through it so they always agree.
+func HeadingID(slugger utils.Slugger, text string) string {
+	if id := slugger.Slugify(text); id != "" {
+		return id
+	}
+	return "heading"
+}
+
+// headingIDs generates heading ids with the site's slug rules. The first
+// heading with a given id keeps it and later ones get a numbered suffix
+// (setup, setup-1, setup-2), so a fragment always links to the first one.
+type headingIDs struct {
+	slugger utils.Slugger
+	values  map[string]bool
+}
+
+// NewHeadingIDs returns the ids of a single document. Pass it to the parser
+// with parser.WithIDs.
+func NewHeadingIDs(slugger utils.Slugger) parser.IDs {
+	return &headingIDs{
+		slugger: slugger,
+		values:  make(map[string]bool),
+	}
+}
+
+func (s *headingIDs) Generate(value []byte, _ ast.NodeKind) []byte {
+	result := HeadingID(s.slugger, string(StripComments(value)))
+
+	if !s.values[result] {
+		s.values[result] = true
+		return []byte(result)
+	}
+
+	for i := 1; ; i++ {
+		newResult := fmt.Sprintf("%s-%d", result, i)
+		if !s.values[newResult] {
+			s.values[newResult] = true
+			return []byte(newResult)
+		}
+	}
+}
+
+func (s *headingIDs) Put(value []byte) {
+	s.values[string(value)] = true
+}
+
+// reassignHeadingIDs generates the ids of the headings left in doc again, in
+// order, once others were removed after parsing, so the ids the removed ones
+// held go to the headings that remain instead of numbering them.
+func reassignHeadingIDs(doc ast.Node, removed []ast.Node, source []byte, pc parser.Context) {
+	ids, ok := pc.IDs().(*headingIDs)
+	if !ok {
+		return
+	}
+
+	release := func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if entering && n.Kind() == ast.KindHeading {
+			if id, ok := n.AttributeString("id"); ok {
+				delete(ids.values, string(id.([]byte)))
+			}
+		}
+		return ast.WalkContinue, nil
+	}
+	for _, n := range removed {
+		_ = ast.Walk(n, release)
+	}
+	_ = ast.Walk(doc, release)
+
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		heading, ok := n.(*ast.Heading)
+		if !entering || !ok {
+			return ast.WalkContinue, nil
+		}
+		if _, ok := heading.AttributeString("id"); !ok {
+			return ast.WalkContinue, nil
+		}
+		// The same text goldmark generated the id from.
+		var line []byte
+		if lines := heading.Lines(); lines.Len() > 0 {
+			last := lines.At(lines.Len() - 1)
+			line = last.Value(source)
+		}
+		heading.SetAttributeString("id", ids.Generate(line, ast.KindHeading))
+		return ast.WalkContinue, nil
+	})
+}
@@ -0,0 +1,375 @@
+package extensions
+
+import (
+	"blaze/internal/markdown/highlighting"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/alecthomas/chroma/v2/lexers"
+	gast "github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+)
+
+// IncludeErrorsKey holds the source file embeds that could not be resolved,
+// separated by commas.
+var IncludeErrorsKey = parser.NewContextKey()
+
+// includeLanguage is the language of the fenced include directive:
+//
+//	```include
+//	file: cmd/ssg/main.go
+//	region: setup
+//	```
+const includeLanguage = "include"
+
+// reLineRange matches a line range such as 10-20 or L10-L20, or a single line.
+var reLineRange = regexp.MustCompile(`^L?(\d+)(?:-L?(\d+))?$`)
+
+var (
+	reRegionStart = regexp.MustCompile(`#region\s+(\S+)`)
+	reRegionEnd   = regexp.MustCompile(`#endregion\b`)
+)
+
+// -----------------------------------------------------------------------------
+// AST Transformer
+// -----------------------------------------------------------------------------
+
+// includeTransformer replaces source file embeds with the highlighted code
+// of the file. A file is embedded by ![[main.go]] alone in a paragraph, with
+// an optional #L10-20 line range or #name region, or by an include fenced
+// code block.
+type includeTransformer struct {
+	files FileResolver
+}
+
+func (t *includeTransformer) Transform(doc *gast.Document, reader text.Reader, pc parser.Context) {
+	source := reader.Source()
+
+	var replacements [][2]gast.Node
+	var errs []string
+	_ = gast.Walk(doc, func(n gast.Node, entering bool) (gast.WalkStatus, error) {
+		if !entering {
+			return gast.WalkContinue, nil
+		}
+
+		var spec includeSpec
+		switch node := n.(type) {
+		case *gast.Paragraph:
+			link := soleEmbed(node, source)
+			if link == nil || !isSourceFile(string(link.Target)) {
+				return gast.WalkSkipChildren, nil
+			}
+			spec = includeSpec{file: string(link.Target)}
+			spec.selectFragment(string(link.Fragment))
+		case *gast.FencedCodeBlock:
+			if string(node.Language(source)) != includeLanguage {
+				return gast.WalkSkipChildren, nil
+			}
+			spec = parseIncludeSpec(node, source)
+		default:
+			return gast.WalkContinue, nil
+		}
+
+		code, err := t.include(spec)
+		if err != nil {
+			errs = append(errs, err.Error())
+			return gast.WalkSkipChildren, nil
+		}
+
+		language := spec.language
+		if language == "" {
+			language = languageOf(spec.file)
+		}
+		embed := &highlighting.SourceCode{
+			Language: []byte(language),
+			Code:     code,
+			Title:    spec.file,
+		}
+		if block, ok := n.(*gast.FencedCodeBlock); ok {
+			copyInfoAttributes(embed, block, source)
+		}
+		replacements = append(replacements, [2]gast.Node{n, embed})
+		return gast.WalkSkipChildren, nil
+	})
+
+	for _, r := range replacements {
+		r[0].Parent().ReplaceChild(r[0].Parent(), r[0], r[1])
+	}
+	reportIncludeErrors(pc, errs)
+}
+
+// reportIncludeErrors adds errs to the embeds of the page that could not be
+// resolved, which every kind of file embed reports to.
+func reportIncludeErrors(pc parser.Context, errs []string) {
+	if len(errs) == 0 {
+		return
+	}
+	if previous, ok := pc.Get(IncludeErrorsKey).(string); ok {
+		errs = append([]string{previous}, errs...)
+	}
+	pc.Set(IncludeErrorsKey, strings.Join(dedupe(errs), ", "))
+}
+
+// soleEmbed returns the embed wikilink that is the only content of a
+// paragraph, if any.
+func soleEmbed(p *gast.Paragraph, source []byte) *WikilinkNode {
+	link, ok := soleInline(p, source).(*WikilinkNode)
+	if !ok || !link.Embed {
+		return nil
+	}
+	return link
+}
+
+// soleInline returns the only inline of a paragraph besides blank text, if
+// any.
+func soleInline(p *gast.Paragraph, source []byte) gast.Node {
+	var sole gast.Node
+	for c := p.FirstChild(); c != nil; c = c.NextSibling() {
+		if text, ok := c.(*gast.Text); ok && len(bytes.TrimSpace(text.Segment.Value(source))) == 0 {
+			continue
+		}
+		if sole != nil {
+			return nil
+		}
+		sole = c
+	}
+	return sole
+}
+
+// isSourceFile reports whether name is a file that embeds as code: one that
+// is not a note, media or data and whose language is known from its name.
+func isSourceFile(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	if ext == "" || ext == ".md" || mediaKind(name) != "" || dataComma(name) != 0 {
+		return false
+	}
+	return lexers.Match(filepath.Base(name)) != nil
+}
+
+// languageOf returns the highlighting language of a file, from its name.
+func languageOf(name string) string {
+	lexer := lexers.Match(filepath.Base(name))
+	if lexer == nil {
+		return ""
+	}
+	config := lexer.Config()
+	if len(config.Aliases) > 0 {
+		return config.Aliases[0]
+	}
+	return strings.ToLower(config.Name)
+}
+
+// copyInfoAttributes gives embed the attributes in the info string of the
+// include block, such as {hl_lines=[2] title="Setup"}.
+func copyInfoAttributes(embed gast.Node, block *gast.FencedCodeBlock, source []byte) {
+	if block.Info == nil {
+		return
+	}
+	info := block.Info.Segment.Value(source)
+	i := bytes.IndexByte(info, '{')
+	if i < 0 {
+		return
+	}
+	attrs, ok := parser.ParseAttributes(text.NewReader(info[i:]))
+	if !ok {
+		return
+	}
+	for _, attr := range attrs {
+		embed.SetAttribute(attr.Name, attr.Value)
+	}
+}
+
+// -----------------------------------------------------------------------------
+// Include Spec
+// -----------------------------------------------------------------------------
+
+// includeSpec is what to include of a file.
+type includeSpec struct {
+	file string
+	// from and to are the first and last line, starting at 1. Zero means
+	// the start or the end of the file.
+	from, to int
+	region   string
+	language string
+}
+
+// selectFragment applies the #L10-20 or #region part of an embed.
+func (s *includeSpec) selectFragment(fragment string) {
+	if fragment == "" {
+		return
+	}
+	if !s.selectLines(fragment) {
+		s.region = fragment
+	}
+}
+
+// selectLines sets the line range, reporting whether lines is one.
+func (s *includeSpec) selectLines(lines string) bool {
+	m := reLineRange.FindStringSubmatch(strings.TrimSpace(lines))
+	if m == nil {
+		return false
+	}
+	s.from, _ = strconv.Atoi(m[1])
+	s.to = s.from
+	if m[2] != "" {
+		s.to, _ = strconv.Atoi(m[2])
+	}
+	return true
+}
+
+// parseIncludeSpec reads the "key: value" lines of an include block. A line
+// without a key is the file.
+func parseIncludeSpec(block *gast.FencedCodeBlock, source []byte) includeSpec {
+	var spec includeSpec
+	lines := block.Lines()
+	for i := 0; i < lines.Len(); i++ {
+		segment := lines.At(i)
+		line := strings.TrimSpace(string(segment.Value(source)))
+		if line == "" {
+			continue
+		}
+
+		key, value, found := strings.Cut(line, ":")
+		if !found {
+			spec.file = line
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch strings.ToLower(strings.TrimSpace(key)) {
+		case "file":
+			spec.file = value
+		case "lines":
+			if !spec.selectLines(value) {
+				spec.from = -1
+			}
+		case "region":
+			spec.region = value
+		case "lang", "language":
+			spec.language = value
+		default:
+			spec.file = line
+		}
+	}
+	return spec
+}
+
+// include reads the part of the file spec selects.
+func (t *includeTransformer) include(spec includeSpec) ([]byte, error) {
+	if spec.file == "" {
+		return nil, fmt.Errorf("include without a file")
+	}
+	if spec.from < 0 {
+		return nil, fmt.Errorf("%s: invalid lines", spec.file)
+	}
+
+	path, ok := t.files.ResolveFile(spec.file)
+	if !ok {
+		return nil, fmt.Errorf("%s: not found", spec.file)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", spec.file, err)
+	}
+
+	lines := strings.SplitAfter(string(content), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	switch {
+	case spec.region != "":
+		lines = region(lines, spec.region)
+		if lines == nil {
+			return nil, fmt.Errorf("%s: no region %q", spec.file, spec.region)
+		}
+	case spec.from > 0:
+		if spec.from > len(lines) || spec.to < spec.from {
+			return nil, fmt.Errorf("%s: no lines %d-%d", spec.file, spec.from, spec.to)
+		}
+		lines = lines[spec.from-1 : min(spec.to, len(lines))]
+	default:
+		return []byte(strings.Join(withoutMarkers(lines), "")), nil
+	}
+
+	code := strings.Join(dedent(lines), "")
+	if !strings.HasSuffix(code, "\n") {
+		code += "\n"
+	}
+	return []byte(code), nil
+}
+
+// region returns the lines between the #region name and #endregion marker
+// comments, without the markers of the region or of regions nested in it.
+func region(lines []string, name string) []string {
+	start := -1
+	depth := 0
+	for i, line := range lines {
+		if m := reRegionStart.FindStringSubmatch(line); m != nil {
+			if start < 0 && m[1] == name {
+				start = i + 1
+				depth = 0
+			} else if start >= 0 {
+				depth++
+			}
+			continue
+		}
+		if start < 0 || !reRegionEnd.MatchString(line) {
+			continue
+		}
+		if depth > 0 {
+			depth--
+			continue
+		}
+
+		if out := withoutMarkers(lines[start:i]); out != nil {
+			return out
+		}
+		return []string{}
+	}
+	return nil
+}
+
+// withoutMarkers removes the region marker comments from lines.
+func withoutMarkers(lines []string) []string {
+	var out []string
+	for _, line := range lines {
+		if !reRegionStart.MatchString(line) && !reRegionEnd.MatchString(line) {
+			out = append(out, line)
+		}
+	}
+	return out
+}
+
+// dedent removes the indentation the lines have in common.
+func dedent(lines []string) []string {
+	prefix := ""
+	first := true
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+		if first {
+			prefix, first = indent, false
+			continue
+		}
+		for !strings.HasPrefix(indent, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+
+	if prefix == "" {
+		return lines
+	}
+	out := make([]string, len(lines))
+	for i, line := range lines {
+		out[i] = strings.TrimPrefix(line, prefix)
+	}
+	return out
+}
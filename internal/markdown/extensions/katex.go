@@ -1,7 +1,10 @@
 package extensions
 
 import (
+	"blaze/internal/markdown/mathml"
 	"bytes"
+	"errors"
+	"strings"
 
 	"github.com/yuin/goldmark"
 	gast "github.com/yuin/goldmark/ast"
@@ -19,6 +22,9 @@ import (
 type Math struct {
 	gast.BaseInline
 	IsDisplay bool
+	// MathML is the formula converted at build time. If empty, KaTeX renders
+	// it in the browser.
+	MathML string
 }
 
 var KindMath = gast.NewNodeKind("Math")
@@ -146,6 +152,68 @@ func (s *mathParser) Parse(parent gast.Node, block text.Reader, pc parser.Contex
 	return nil
 }
 
+// -----------------------------------------------------------------------------
+// AST Transformer
+// -----------------------------------------------------------------------------
+
+// mathMLTransformer converts formulas to MathML. Formulas using constructs
+// the converter does not support are left to KaTeX; those constructs are
+// listed under MathFallbackKey.
+type mathMLTransformer struct{}
+
+func (t *mathMLTransformer) Transform(doc *gast.Document, reader text.Reader, pc parser.Context) {
+	source := reader.Source()
+
+	var fallback []string
+	_ = gast.Walk(doc, func(n gast.Node, entering bool) (gast.WalkStatus, error) {
+		if !entering {
+			return gast.WalkContinue, nil
+		}
+
+		node, ok := n.(*Math)
+		if !ok {
+			return gast.WalkContinue, nil
+		}
+
+		var tex bytes.Buffer
+		for c := node.FirstChild(); c != nil; c = c.NextSibling() {
+			tex.Write(c.(*gast.Text).Segment.Value(source))
+		}
+
+		out, err := mathml.Render(tex.String(), node.IsDisplay)
+		var unsupported *mathml.UnsupportedError
+		switch {
+		case err == nil:
+			node.MathML = out
+		case errors.As(err, &unsupported):
+			fallback = append(fallback, unsupported.Construct)
+		default:
+			fallback = append(fallback, err.Error())
+		}
+		return gast.WalkSkipChildren, nil
+	})
+
+	if len(fallback) == 0 {
+		// Pages without client-side math don't load KaTeX.
+		pc.Set(KatexContextKey, nil)
+		return
+	}
+	pc.Set(MathFallbackKey, strings.Join(dedupe(fallback), ", "))
+}
+
+// dedupe removes repeated strings, keeping the first occurrence.
+func dedupe(list []string) []string {
+	seen := make(map[string]bool)
+	var out []string
+	for _, s := range list {
+		if !seen[s] {
+			seen[s] = true
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
 // -----------------------------------------------------------------------------
 // HTML Renderer
 // -----------------------------------------------------------------------------
@@ -171,6 +239,10 @@ func (r *mathRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
 func (r *mathRenderer) renderMath(w util.BufWriter, source []byte, n gast.Node, entering bool) (gast.WalkStatus, error) {
 	mathNode := n.(*Math)
 	if entering {
+		if mathNode.MathML != "" {
+			_, _ = w.WriteString(mathNode.MathML)
+			return gast.WalkSkipChildren, nil
+		}
 
 		if mathNode.IsDisplay {
 			_, _ = w.WriteString("$$")
@@ -181,7 +253,11 @@ func (r *mathRenderer) renderMath(w util.BufWriter, source []byte, n gast.Node,
 		for c := n.FirstChild(); c != nil; c = c.NextSibling() {
 			segment := c.(*gast.Text).Segment
 			value := segment.Value(source)
-			_, _ = w.Write(value)
+			if r.Unsafe {
+				_, _ = w.Write(value)
+			} else {
+				_, _ = w.Write(util.EscapeHTML(value))
+			}
 		}
 
 		if mathNode.IsDisplay {
@@ -199,16 +275,41 @@ func (r *mathRenderer) renderMath(w util.BufWriter, source []byte, n gast.Node,
 // Extension
 // -----------------------------------------------------------------------------
 
-type katex struct{}
+type katex struct {
+	mathML bool
+}
+
+// Math rendering modes, selected by the mathRendering config option.
+const (
+	// MathClient renders formulas with KaTeX in the browser.
+	MathClient = "client"
+	// MathML converts formulas to MathML at build time.
+	MathML = "mathml"
+)
 
+// Katex leaves formulas to KaTeX, which renders them in the browser.
 var Katex = &katex{}
 
+// KatexMathML converts formulas to MathML at build time and leaves only the
+// ones it cannot convert to KaTeX.
+var KatexMathML = &katex{mathML: true}
+
+// KatexContextKey is set in the parser context when the page needs KaTeX.
 var KatexContextKey = parser.NewContextKey()
 
+// MathFallbackKey holds the TeX constructs that made formulas fall back to
+// KaTeX, separated by commas.
+var MathFallbackKey = parser.NewContextKey()
+
 func (e *katex) Extend(m goldmark.Markdown) {
 	m.Parser().AddOptions(parser.WithInlineParsers(
 		util.Prioritized(NewMathParser(), 500),
 	))
+	if e.mathML {
+		m.Parser().AddOptions(parser.WithASTTransformers(
+			util.Prioritized(&mathMLTransformer{}, 180),
+		))
+	}
 	m.Renderer().AddOptions(renderer.WithNodeRenderers(
 		util.Prioritized(newMathRenderer(), 500),
 	))
@@ -114,7 +114,11 @@ func (r *mermaidRenderer) renderMermaidBlock(w util.BufWriter, source []byte, n
 		lines := n.Lines()
 		for i := 0; i < lines.Len(); i++ {
 			line := lines.At(i)
-			_, _ = w.Write(line.Value(source))
+			if r.Unsafe {
+				_, _ = w.Write(line.Value(source))
+			} else {
+				_, _ = w.Write(util.EscapeHTML(line.Value(source)))
+			}
 		}
 	} else {
 		_, _ = w.WriteString("</div>")
@@ -0,0 +1,187 @@
+package extensions
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	meta "github.com/yuin/goldmark-meta"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// PrivateHeadingsKey is the frontmatter key listing the headings whose
+// sections are left out of the page.
+const PrivateHeadingsKey = "privateHeadings"
+
+// privateTransformer removes the parts of a note that are kept internal:
+//
+//   - callouts of type private (> [!private])
+//   - code fences with the language private (```private)
+//   - sections under a heading listed in the privateHeadings frontmatter,
+//     down to the next heading of the same or a higher level
+//
+// It runs after callouts are built and before anything else looks at the
+// document, so private content never reaches the output. Heading ids and the
+// need for KaTeX are settled while parsing, so they are worked out again
+// without the private content.
+type privateTransformer struct{}
+
+func (t *privateTransformer) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	source := reader.Source()
+
+	var private []ast.Node
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+
+		switch node := n.(type) {
+		case *CalloutNode:
+			if node.CalloutType == "private" {
+				private = append(private, node)
+				return ast.WalkSkipChildren, nil
+			}
+		case *ast.FencedCodeBlock:
+			if string(node.Language(source)) == "private" {
+				private = append(private, node)
+			}
+		}
+		return ast.WalkContinue, nil
+	})
+
+	for _, n := range private {
+		if parent := n.Parent(); parent != nil {
+			parent.RemoveChild(parent, n)
+		}
+	}
+
+	private = append(private, removePrivateSections(doc, source, pc)...)
+	if len(private) == 0 {
+		return
+	}
+	reassignHeadingIDs(doc, private, source, pc)
+	if containsKind(private, KindMath) && !containsKind([]ast.Node{doc}, KindMath) {
+		pc.Set(KatexContextKey, nil)
+	}
+}
+
+// removePrivateSections removes the sections under the headings listed in
+// the frontmatter, and returns the nodes removed.
+func removePrivateSections(doc *ast.Document, source []byte, pc parser.Context) []ast.Node {
+	headings := privateHeadings(pc)
+	if len(headings) == 0 {
+		return nil
+	}
+
+	var removed []ast.Node
+	for n := doc.FirstChild(); n != nil; {
+		heading, ok := n.(*ast.Heading)
+		if !ok || !headings[normalizeHeading(headingText(heading, source))] {
+			n = n.NextSibling()
+			continue
+		}
+
+		// Drop the heading and its section.
+		next := heading.NextSibling()
+		doc.RemoveChild(doc, heading)
+		removed = append(removed, heading)
+		for next != nil {
+			if h, ok := next.(*ast.Heading); ok && h.Level <= heading.Level {
+				break
+			}
+			following := next.NextSibling()
+			doc.RemoveChild(doc, next)
+			removed = append(removed, next)
+			next = following
+		}
+		n = next
+	}
+	return removed
+}
+
+// containsKind reports whether a node of the kind is among nodes or their
+// descendants.
+func containsKind(nodes []ast.Node, kind ast.NodeKind) bool {
+	found := false
+	for _, n := range nodes {
+		_ = ast.Walk(n, func(c ast.Node, entering bool) (ast.WalkStatus, error) {
+			if entering && c.Kind() == kind {
+				found = true
+				return ast.WalkStop, nil
+			}
+			return ast.WalkContinue, nil
+		})
+	}
+	return found
+}
+
+// privateHeadings returns the normalized headings listed in the frontmatter,
+// as a list or a single string.
+func privateHeadings(pc parser.Context) map[string]bool {
+	value, ok := meta.Get(pc)[PrivateHeadingsKey]
+	if !ok {
+		return nil
+	}
+
+	var names []string
+	switch v := value.(type) {
+	case []interface{}:
+		for _, name := range v {
+			names = append(names, fmt.Sprint(name))
+		}
+	case nil:
+	default:
+		names = append(names, fmt.Sprint(v))
+	}
+
+	headings := make(map[string]bool, len(names))
+	for _, name := range names {
+		if name = normalizeHeading(name); name != "" {
+			headings[name] = true
+		}
+	}
+	return headings
+}
+
+// headingText returns the text of a heading as written, without inline
+// markup.
+func headingText(n ast.Node, source []byte) string {
+	var b strings.Builder
+	_ = ast.Walk(n, func(c ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch node := c.(type) {
+		case *ast.Text:
+			b.Write(node.Segment.Value(source))
+			if node.SoftLineBreak() {
+				b.WriteByte(' ')
+			}
+		case *ast.String:
+			b.Write(node.Value)
+		}
+		return ast.WalkContinue, nil
+	})
+	return b.String()
+}
+
+func normalizeHeading(s string) string {
+	return strings.ToLower(strings.Join(strings.Fields(s), " "))
+}
+
+type private struct{}
+
+// Private removes private callouts, private code fences and the sections
+// listed in the privateHeadings frontmatter.
+var Private = &private{}
+
+func (e *private) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(
+		parser.WithASTTransformers(
+			util.Prioritized(&privateTransformer{}, 160),
+		),
+	)
+}
@@ -0,0 +1,239 @@
+package extensions
+
+import (
+	"bytes"
+
+	"github.com/yuin/goldmark"
+	gast "github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// Raw HTML modes, selected by the rawHTML config option.
+const (
+	// RawHTMLAllow passes raw HTML through unchanged.
+	RawHTMLAllow = "allow"
+	// RawHTMLStrip removes raw HTML.
+	RawHTMLStrip = "strip"
+	// RawHTMLSanitize keeps allowlisted elements and attributes of raw HTML.
+	RawHTMLSanitize = "sanitize"
+)
+
+// RawHTMLModifiedKey is set in the parser context when raw HTML or an unsafe
+// link was removed from the document.
+var RawHTMLModifiedKey = parser.NewContextKey()
+
+// -----------------------------------------------------------------------------
+// Node Definition
+// -----------------------------------------------------------------------------
+
+// SanitizedHTML is inline raw HTML that went through the sanitizer.
+type SanitizedHTML struct {
+	gast.BaseInline
+	Value []byte
+}
+
+var KindSanitizedHTML = gast.NewNodeKind("SanitizedHTML")
+
+func (n *SanitizedHTML) Kind() gast.NodeKind {
+	return KindSanitizedHTML
+}
+
+func (n *SanitizedHTML) Dump(source []byte, level int) {
+	gast.DumpHelper(n, source, level, nil, nil)
+}
+
+// SanitizedHTMLBlock is an HTML block that went through the sanitizer.
+type SanitizedHTMLBlock struct {
+	gast.BaseBlock
+	Value []byte
+}
+
+var KindSanitizedHTMLBlock = gast.NewNodeKind("SanitizedHTMLBlock")
+
+func (n *SanitizedHTMLBlock) Kind() gast.NodeKind {
+	return KindSanitizedHTMLBlock
+}
+
+func (n *SanitizedHTMLBlock) IsRaw() bool {
+	return true
+}
+
+func (n *SanitizedHTMLBlock) Dump(source []byte, level int) {
+	gast.DumpHelper(n, source, level, nil, nil)
+}
+
+// -----------------------------------------------------------------------------
+// AST Transformer
+// -----------------------------------------------------------------------------
+
+// rawHTMLTransformer strips or sanitizes the raw HTML of a document. Links
+// and images with a dangerous URL, such as javascript:, are not rendered by
+// goldmark's safe mode and are only counted here.
+type rawHTMLTransformer struct {
+	mode string
+}
+
+func (t *rawHTMLTransformer) Transform(doc *gast.Document, reader text.Reader, pc parser.Context) {
+	source := reader.Source()
+
+	var raw []gast.Node
+	modified := false
+	_ = gast.Walk(doc, func(n gast.Node, entering bool) (gast.WalkStatus, error) {
+		if !entering {
+			return gast.WalkContinue, nil
+		}
+
+		switch node := n.(type) {
+		case *gast.RawHTML, *gast.HTMLBlock:
+			raw = append(raw, node)
+			return gast.WalkSkipChildren, nil
+		case *gast.Link:
+			modified = modified || html.IsDangerousURL(node.Destination)
+		case *gast.Image:
+			modified = modified || html.IsDangerousURL(node.Destination)
+		}
+		return gast.WalkContinue, nil
+	})
+
+	for _, n := range raw {
+		parent := n.Parent()
+		if parent == nil {
+			continue
+		}
+
+		value := rawHTMLValue(n, source)
+		sanitized, changed, open := sanitizeHTML(value)
+		if open != "" {
+			// The text up to the closing tag is the element's content.
+			removeUntilClosed(n, open, source)
+		}
+
+		if t.mode == RawHTMLStrip {
+			modified = modified || len(bytes.TrimSpace(value)) > 0
+			parent.RemoveChild(parent, n)
+			if parent.Kind() == gast.KindParagraph && isBlankParagraph(parent, source) && parent.Parent() != nil {
+				parent.Parent().RemoveChild(parent.Parent(), parent)
+			}
+			continue
+		}
+
+		modified = modified || changed
+		if n.Type() == gast.TypeBlock {
+			parent.ReplaceChild(parent, n, &SanitizedHTMLBlock{Value: sanitized})
+		} else {
+			parent.ReplaceChild(parent, n, &SanitizedHTML{Value: sanitized})
+		}
+	}
+
+	if modified {
+		pc.Set(RawHTMLModifiedKey, true)
+	}
+}
+
+// removeUntilClosed removes the siblings after n up to and including the raw
+// HTML that closes the element open.
+func removeUntilClosed(n gast.Node, open string, source []byte) {
+	parent := n.Parent()
+	closing := []byte("</" + open)
+	for next := n.NextSibling(); next != nil; {
+		following := next.NextSibling()
+		parent.RemoveChild(parent, next)
+		if next.Kind() == gast.KindRawHTML && bytes.Contains(bytes.ToLower(rawHTMLValue(next, source)), closing) {
+			return
+		}
+		next = following
+	}
+}
+
+// rawHTMLValue returns the source of a raw HTML node.
+func rawHTMLValue(n gast.Node, source []byte) []byte {
+	var buf bytes.Buffer
+	switch node := n.(type) {
+	case *gast.RawHTML:
+		for i := 0; i < node.Segments.Len(); i++ {
+			segment := node.Segments.At(i)
+			buf.Write(segment.Value(source))
+		}
+	case *gast.HTMLBlock:
+		lines := node.Lines()
+		for i := 0; i < lines.Len(); i++ {
+			segment := lines.At(i)
+			buf.Write(segment.Value(source))
+		}
+		if node.HasClosure() {
+			buf.Write(node.ClosureLine.Value(source))
+		}
+	}
+	return buf.Bytes()
+}
+
+// -----------------------------------------------------------------------------
+// HTML Renderer
+// -----------------------------------------------------------------------------
+
+type sanitizedHTMLRenderer struct{}
+
+func (r *sanitizedHTMLRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(KindSanitizedHTML, r.renderSanitizedHTML)
+	reg.Register(KindSanitizedHTMLBlock, r.renderSanitizedHTML)
+}
+
+func (r *sanitizedHTMLRenderer) renderSanitizedHTML(w util.BufWriter, source []byte, n gast.Node, entering bool) (gast.WalkStatus, error) {
+	if !entering {
+		return gast.WalkContinue, nil
+	}
+
+	switch node := n.(type) {
+	case *SanitizedHTML:
+		_, _ = w.Write(node.Value)
+	case *SanitizedHTMLBlock:
+		_, _ = w.Write(node.Value)
+	}
+	return gast.WalkSkipChildren, nil
+}
+
+// -----------------------------------------------------------------------------
+// Extension
+// -----------------------------------------------------------------------------
+
+type rawHTML struct {
+	mode string
+}
+
+// RawHTML strips or sanitizes raw HTML depending on mode. With RawHTMLAllow
+// it does nothing; the renderer must then be configured with html.WithUnsafe.
+func RawHTML(mode string) goldmark.Extender {
+	return &rawHTML{mode: mode}
+}
+
+func (e *rawHTML) Extend(m goldmark.Markdown) {
+	if e.mode == RawHTMLAllow {
+		return
+	}
+
+	m.Parser().AddOptions(
+		parser.WithASTTransformers(
+			util.Prioritized(&rawHTMLTransformer{mode: e.mode}, 170),
+		),
+	)
+	m.Renderer().AddOptions(
+		renderer.WithNodeRenderers(
+			util.Prioritized(&sanitizedHTMLRenderer{}, 500),
+		),
+	)
+}
+
+// FilterHTML applies mode to a page written in HTML rather than Markdown,
+// reporting whether anything was removed. The page is sanitized under
+// RawHTMLStrip too, since stripping its HTML would leave nothing of it.
+func FilterHTML(mode string, page []byte) ([]byte, bool) {
+	if mode == RawHTMLAllow {
+		return page, false
+	}
+	sanitized, changed, _ := sanitizeHTML(page)
+	return sanitized, changed
+}
@@ -0,0 +1,306 @@
+package extensions
+
+import (
+	"bytes"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// allowedTags are the elements kept by sanitizing, with the attributes each
+// may have on top of globalAttributes. They cover what notes usually write by
+// hand and the markup callouts, KaTeX and the other extensions emit.
+var allowedTags = map[string][]string{
+	"a":          {"href", "name", "target", "rel"},
+	"abbr":       nil,
+	"b":          nil,
+	"blockquote": {"cite"},
+	"br":         nil,
+	"caption":    nil,
+	"center":     nil,
+	"cite":       nil,
+	"code":       nil,
+	"col":        {"span", "width"},
+	"colgroup":   {"span"},
+	"dd":         nil,
+	"del":        {"cite", "datetime"},
+	"details":    {"open"},
+	"dfn":        nil,
+	"div":        nil,
+	"dl":         nil,
+	"dt":         nil,
+	"em":         nil,
+	"figcaption": nil,
+	"figure":     nil,
+	"font":       {"color"},
+	"h1":         nil,
+	"h2":         nil,
+	"h3":         nil,
+	"h4":         nil,
+	"h5":         nil,
+	"h6":         nil,
+	"hr":         nil,
+	"i":          nil,
+	"iframe":     {"src", "width", "height", "allow", "allowfullscreen", "frameborder", "loading", "referrerpolicy"},
+	"img":        {"src", "alt", "width", "height", "loading"},
+	"ins":        {"cite", "datetime"},
+	"kbd":        nil,
+	"li":         {"value"},
+	"mark":       nil,
+	"ol":         {"start", "type", "reversed"},
+	"p":          nil,
+	"pre":        nil,
+	"q":          {"cite"},
+	"rp":         nil,
+	"rt":         nil,
+	"ruby":       nil,
+	"s":          nil,
+	"samp":       nil,
+	"small":      nil,
+	"span":       nil,
+	"strike":     nil,
+	"strong":     nil,
+	"sub":        nil,
+	"summary":    nil,
+	"sup":        nil,
+	"table":      nil,
+	"tbody":      nil,
+	"td":         {"colspan", "rowspan", "align"},
+	"tfoot":      nil,
+	"th":         {"colspan", "rowspan", "align", "scope"},
+	"thead":      nil,
+	"time":       {"datetime"},
+	"tr":         nil,
+	"u":          nil,
+	"ul":         nil,
+	"var":        nil,
+	"wbr":        nil,
+
+	// MathML, as written by KaTeX.
+	"math":       {"display", "xmlns"},
+	"semantics":  nil,
+	"annotation": {"encoding"},
+	"mrow":       nil,
+	"mi":         {"mathvariant"},
+	"mn":         nil,
+	"mo":         {"stretchy", "fence", "separator", "lspace", "rspace", "minsize", "maxsize"},
+	"ms":         nil,
+	"mtext":      nil,
+	"mspace":     {"width"},
+	"msup":       nil,
+	"msub":       nil,
+	"msubsup":    nil,
+	"mfrac":      {"linethickness"},
+	"msqrt":      nil,
+	"mroot":      nil,
+	"mover":      {"accent"},
+	"munder":     {"accentunder"},
+	"munderover": nil,
+	"mtable":     {"columnalign", "rowspacing", "columnspacing"},
+	"mtr":        nil,
+	"mtd":        nil,
+	"mstyle":     {"displaystyle", "scriptlevel", "mathcolor"},
+	"mpadded":    {"width", "height", "depth", "lspace", "voffset"},
+	"menclose":   {"notation"},
+}
+
+// globalAttributes may appear on any allowed element. data-* and aria-*
+// attributes are allowed too. style is not: inline CSS can lay an element
+// over the whole page.
+var globalAttributes = []string{"class", "id", "title", "lang", "dir", "role", "align", "hidden"}
+
+// droppedContent are elements removed together with everything inside them
+// instead of just their tags.
+var droppedContent = map[string]bool{
+	"script":    true,
+	"style":     true,
+	"template":  true,
+	"textarea":  true,
+	"title":     true,
+	"noscript":  true,
+	"noembed":   true,
+	"noframes":  true,
+	"object":    true,
+	"embed":     true,
+	"applet":    true,
+	"xmp":       true,
+	"plaintext": true,
+	"select":    true,
+}
+
+// urlAttributes hold URLs, which must be relative or use a safe scheme.
+var urlAttributes = map[string]bool{
+	"href":     true,
+	"src":      true,
+	"cite":     true,
+	"poster":   true,
+	"action":   true,
+	"longdesc": true,
+}
+
+var safeSchemes = map[string]bool{
+	"http":   true,
+	"https":  true,
+	"mailto": true,
+	"tel":    true,
+}
+
+// iframeHosts are the sites an iframe may embed.
+var iframeHosts = map[string]bool{
+	"www.youtube.com":          true,
+	"youtube.com":              true,
+	"www.youtube-nocookie.com": true,
+	"player.vimeo.com":         true,
+}
+
+// sanitizeHTML keeps the allowed elements and attributes of raw, a fragment
+// of raw HTML, and drops everything else. It reports whether anything was
+// dropped; quoting and escaping are normalized either way. If raw ends inside
+// an element that is dropped with its content, such as an inline <script>
+// whose closing tag is in a later node, that element is returned as open.
+func sanitizeHTML(raw []byte) (sanitized []byte, changed bool, open string) {
+	var out bytes.Buffer
+	skip := ""
+
+	z := html.NewTokenizer(bytes.NewReader(raw))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			// Also at the end of the input.
+			break
+		}
+
+		token := z.Token()
+
+		if skip != "" {
+			changed = true
+			if tt == html.EndTagToken && token.Data == skip {
+				skip = ""
+			}
+			continue
+		}
+
+		switch tt {
+		case html.TextToken:
+			out.WriteString(html.EscapeString(token.Data))
+		case html.CommentToken:
+			out.WriteString("<!--")
+			out.WriteString(token.Data)
+			out.WriteString("-->")
+		case html.StartTagToken, html.SelfClosingTagToken:
+			if !allowedTag(token) {
+				changed = true
+				if tt == html.StartTagToken && (droppedContent[token.Data] || token.Data == "iframe") {
+					skip = token.Data
+				}
+				continue
+			}
+			if sanitizeAttributes(&token) {
+				changed = true
+			}
+			out.WriteString(token.String())
+		case html.EndTagToken:
+			if _, ok := allowedTags[token.Data]; !ok {
+				changed = true
+				continue
+			}
+			out.WriteString(token.String())
+		default:
+			// Doctypes and other declarations.
+			changed = true
+		}
+	}
+
+	return out.Bytes(), changed, skip
+}
+
+func allowedTag(token html.Token) bool {
+	if _, ok := allowedTags[token.Data]; !ok {
+		return false
+	}
+	if token.Data != "iframe" {
+		return true
+	}
+
+	for _, attr := range token.Attr {
+		if attr.Key != "src" {
+			continue
+		}
+		u, err := url.Parse(strings.TrimSpace(attr.Val))
+		return err == nil && u.Scheme == "https" && iframeHosts[u.Host]
+	}
+	return false
+}
+
+// sanitizeAttributes removes the attributes token may not have and reports
+// whether it removed any. Links that open in another tab get
+// rel="noopener noreferrer", so the opened page cannot navigate this one.
+func sanitizeAttributes(token *html.Token) bool {
+	allowed := allowedTags[token.Data]
+	kept := token.Attr[:0]
+	changed := false
+	target := false
+
+	for _, attr := range token.Attr {
+		key := strings.ToLower(attr.Key)
+		ok := attr.Namespace == "" && (contains(allowed, key) || contains(globalAttributes, key) ||
+			strings.HasPrefix(key, "data-") || strings.HasPrefix(key, "aria-"))
+		if ok && urlAttributes[key] {
+			ok = safeURL(attr.Val)
+		}
+		if !ok {
+			changed = true
+			continue
+		}
+		if key == "target" {
+			target = true
+		}
+		kept = append(kept, attr)
+	}
+
+	if target {
+		kept = setAttribute(kept, "rel", "noopener noreferrer")
+	}
+
+	token.Attr = kept
+	return changed
+}
+
+// safeURL reports whether u is relative or uses a safe scheme. Browsers
+// ignore whitespace and control characters in schemes, so they are removed
+// before looking at it.
+func safeURL(u string) bool {
+	cleaned := strings.Map(func(r rune) rune {
+		if r <= ' ' || r == 0x7f {
+			return -1
+		}
+		return r
+	}, u)
+
+	colon := strings.IndexByte(cleaned, ':')
+	if colon < 0 || strings.ContainsAny(cleaned[:colon], "/?#") {
+		return true
+	}
+	return safeSchemes[strings.ToLower(cleaned[:colon])]
+}
+
+// setAttribute sets the value of the attribute key, adding it if needed.
+func setAttribute(attrs []html.Attribute, key, val string) []html.Attribute {
+	for i := range attrs {
+		if attrs[i].Key == key {
+			attrs[i].Val = val
+			return attrs
+		}
+	}
+	return append(attrs, html.Attribute{Key: key, Val: val})
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
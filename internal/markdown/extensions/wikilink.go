@@ -1,12 +1,15 @@
 package extensions
 
 import (
+	"blaze/internal/images"
 	"blaze/internal/utils"
 	"bytes"
 	"fmt"
 	"io"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 
@@ -93,8 +96,9 @@ func (p *wikilinkParser) Parse(_ gast.Node, block text.Reader, _ parser.Context)
 		return nil
 	}
 
-	if idx := bytes.LastIndex(n.Target, _hash); idx >= 0 {
-		n.Fragment = n.Target[idx+1:]
+	// [[Note#Section#Subsection]] links to the innermost heading.
+	if idx := bytes.Index(n.Target, _hash); idx >= 0 {
+		n.Fragment = n.Target[bytes.LastIndex(n.Target, _hash)+1:]
 		n.Target = n.Target[:idx]
 	}
 
@@ -111,20 +115,83 @@ type WikilinkResolver interface {
 	ResolveWikilink(*WikilinkNode) (destination []byte, err error)
 }
 
+// FileResolver finds the files of the vault that notes embed as content,
+// such as source code.
+type FileResolver interface {
+	// ResolveFile returns the path of the file target names, by its path
+	// relative to the content directory or its name.
+	ResolveFile(target string) (path string, ok bool)
+}
+
+// ImageResolver finds the images of the vault, which are rendered with
+// their intrinsic size and resized variants.
+type ImageResolver interface {
+	// ResolveImage returns the URL and the size and variants of the image
+	// target names, by its path relative to the content directory, its URL
+	// or its name.
+	ResolveImage(target string) (url string, info images.Info, ok bool)
+}
+
 type slugResolver struct {
 	contentDir string
+	routes     *utils.Routes
+	images     *images.Processor
+	ignore     func(relPath string) bool
+	once       sync.Once
 	index      map[string]string
 	mediaIndex map[string]string
+	mediaFiles map[string]string
+	fileIndex  map[string]string
 }
 
-func NewSlugResolver(contentDir string) WikilinkResolver {
-	r := &slugResolver{
+// NewSlugResolver resolves links to the notes and media under contentDir.
+// URLs are taken from routes, which the pipeline fills in before rendering,
+// so the index is built on first use. A nil routes uses the natural slugs.
+// Images are measured by imgs; a nil imgs renders them without their size.
+// Files for which ignore returns true are left out of the index, so they
+// can neither be linked nor embedded; a nil ignore keeps every file.
+func NewSlugResolver(contentDir string, routes *utils.Routes, imgs *images.Processor, ignore func(relPath string) bool) WikilinkResolver {
+	return &slugResolver{
 		contentDir: contentDir,
+		routes:     routes,
+		images:     imgs,
+		ignore:     ignore,
 		index:      make(map[string]string),
 		mediaIndex: make(map[string]string),
+		mediaFiles: make(map[string]string),
+		fileIndex:  make(map[string]string),
+	}
+}
+
+// url returns the URL of the content file at relPath, or "" for a page left
+// out of the site.
+func (r *slugResolver) url(relPath string, page bool) string {
+	if r.routes != nil {
+		if u, ok := r.routes.URL(relPath); ok {
+			return u
+		}
+		if page {
+			return ""
+		}
+	}
+	if page {
+		return r.slugger().PageURL(relPath, r.urlStyle())
+	}
+	return "/" + filepath.ToSlash(r.slugger().StaticOutputPath(relPath))
+}
+
+func (r *slugResolver) urlStyle() string {
+	if r.routes != nil {
+		return r.routes.Style()
+	}
+	return utils.URLStyleClean
+}
+
+func (r *slugResolver) slugger() utils.Slugger {
+	if r.routes != nil {
+		return r.routes.Slugger()
 	}
-	r.buildIndex()
-	return r
+	return utils.Slugger{}
 }
 
 func (r *slugResolver) buildIndex() {
@@ -134,68 +201,60 @@ func (r *slugResolver) buildIndex() {
 		}
 
 		relPath, _ := filepath.Rel(r.contentDir, path)
+		if r.ignore != nil && r.ignore(relPath) {
+			return nil
+		}
 		ext := filepath.Ext(path)
 
-		if isImage(relPath) {
-			dir := filepath.Dir(relPath)
+		if mediaKind(relPath) != "" {
 			base := filepath.Base(path)
 			nameWithoutExt := strings.TrimSuffix(base, ext)
-
-			slug := utils.PathToSlug(nameWithoutExt)
-			normalizedExt := strings.ToLower(ext)
-			normalizedBase := slug + normalizedExt
-
-			sluggedDir := utils.SlugifyPath(dir)
-
-			var mediaPath string
-			if sluggedDir == "" || sluggedDir == "." {
-				mediaPath = "/" + normalizedBase
-			} else {
-				mediaPath = "/" + sluggedDir + "/" + normalizedBase
+			normalizedBase := r.slugger().PathToSlug(nameWithoutExt) + strings.ToLower(ext)
+			mediaPath := r.url(relPath, false)
+
+			for _, key := range []string{
+				strings.ToLower(base),
+				strings.ToLower(nameWithoutExt),
+				strings.ToLower(normalizedBase),
+				strings.ToLower(filepath.ToSlash(relPath)),
+				strings.ToLower(strings.TrimPrefix(mediaPath, "/")),
+			} {
+				r.mediaIndex[key] = mediaPath
+				r.mediaFiles[key] = relPath
 			}
 
-			key := strings.ToLower(base)
-			r.mediaIndex[key] = mediaPath
-
-			nameKey := strings.ToLower(nameWithoutExt)
-			r.mediaIndex[nameKey] = mediaPath
-
-			normalizedKey := strings.ToLower(normalizedBase)
-			r.mediaIndex[normalizedKey] = mediaPath
-
-			fullPathKey := strings.ToLower(filepath.ToSlash(relPath))
-			r.mediaIndex[fullPathKey] = mediaPath
-
 			return nil
 		}
 
 		if ext != ".md" {
+			r.fileIndex[strings.ToLower(filepath.Base(path))] = relPath
+			r.fileIndex[strings.ToLower(filepath.ToSlash(relPath))] = relPath
+			if IsDrawing(path) {
+				// Canvases and drawings are pages too, linked by their
+				// full name as in [[Board.canvas]].
+				urlPath := r.url(relPath, true)
+				r.index[strings.ToLower(filepath.Base(path))] = urlPath
+				r.index[strings.ToLower(filepath.ToSlash(relPath))] = urlPath
+			}
 			return nil
 		}
 
-		dir := filepath.Dir(relPath)
-		sluggedDir := utils.SlugifyPath(dir)
-		slug := utils.PathToSlug(relPath)
+		if IsDrawing(path) {
+			// Drawings of the Excalidraw plugin are embedded by their name
+			// without .md, as in ![[Sketch.excalidraw]].
+			for _, key := range []string{filepath.Base(path), filepath.ToSlash(relPath)} {
+				key = strings.ToLower(key)
+				r.fileIndex[key] = relPath
+				r.fileIndex[strings.TrimSuffix(key, ".md")] = relPath
+			}
+		}
 
+		dir := filepath.Dir(relPath)
 		base := filepath.Base(path)
 		nameWithoutExt := strings.TrimSuffix(base, ext)
 		key := strings.ToLower(nameWithoutExt)
 
-		var urlPath string
-		if key == "index" {
-			if sluggedDir == "" || sluggedDir == "." {
-				urlPath = "/"
-			} else {
-				urlPath = "/" + sluggedDir
-			}
-		} else {
-			// Untuk file biasa
-			if sluggedDir == "" || sluggedDir == "." {
-				urlPath = "/" + slug
-			} else {
-				urlPath = "/" + sluggedDir + "/" + slug
-			}
-		}
+		urlPath := r.url(relPath, true)
 
 		r.index[key] = urlPath
 
@@ -214,9 +273,18 @@ func (r *slugResolver) buildIndex() {
 }
 
 func (r *slugResolver) ResolveWikilink(n *WikilinkNode) ([]byte, error) {
+	r.once.Do(r.buildIndex)
 	target := string(n.Target)
 
-	if isImage(target) {
+	// [[#Heading]] links to a heading of the current page.
+	if target == "" {
+		if len(n.Fragment) == 0 {
+			return nil, nil
+		}
+		return []byte("#" + HeadingID(r.slugger(), string(n.Fragment))), nil
+	}
+
+	if mediaKind(target) != "" {
 		key := strings.ToLower(target)
 		if mediaPath, found := r.mediaIndex[key]; found {
 			return []byte(mediaPath), nil
@@ -237,12 +305,17 @@ func (r *slugResolver) ResolveWikilink(n *WikilinkNode) ([]byte, error) {
 	key := strings.ToLower(targetWithoutExt)
 	urlPath, found := r.index[key]
 
+	if found && urlPath == "" {
+		// The note exists but is left out of the site, e.g. as a draft.
+		return nil, nil
+	}
+
 	if !found {
-		slug := utils.PathToSlug(targetWithoutExt)
+		slug := r.slugger().PathToSlug(targetWithoutExt)
 		if slug == "" {
 			return nil, nil
 		}
-		urlPath = "/" + slug
+		urlPath = r.slugger().PageURL(slug+".md", r.urlStyle())
 	}
 
 	var dest bytes.Buffer
@@ -250,21 +323,73 @@ func (r *slugResolver) ResolveWikilink(n *WikilinkNode) ([]byte, error) {
 
 	if len(n.Fragment) > 0 {
 		dest.WriteString("#")
-		fragment := string(n.Fragment)
-		normalizedFragment := utils.Slugify(fragment)
-		dest.WriteString(normalizedFragment)
+		dest.WriteString(HeadingID(r.slugger(), string(n.Fragment)))
 	}
 
 	return dest.Bytes(), nil
 }
 
-func isImage(path string) bool {
-	ext := strings.ToLower(filepath.Ext(path))
-	switch ext {
+func (r *slugResolver) ResolveFile(target string) (string, bool) {
+	r.once.Do(r.buildIndex)
+
+	key := strings.ToLower(strings.TrimPrefix(filepath.ToSlash(target), "/"))
+	relPath, found := r.fileIndex[key]
+	if !found {
+		relPath, found = r.fileIndex[strings.ToLower(filepath.Base(target))]
+	}
+	if !found {
+		return "", false
+	}
+	return filepath.Join(r.contentDir, relPath), true
+}
+
+func (r *slugResolver) ResolveImage(target string) (string, images.Info, bool) {
+	if r.images == nil || !images.IsResizable(target) {
+		return "", images.Info{}, false
+	}
+	r.once.Do(r.buildIndex)
+
+	if unescaped, err := url.PathUnescape(target); err == nil {
+		target = unescaped
+	}
+	key := strings.ToLower(strings.TrimLeft(filepath.ToSlash(target), "./"))
+	relPath, found := r.mediaFiles[key]
+	if !found {
+		relPath, found = r.mediaFiles[strings.ToLower(filepath.Base(target))]
+	}
+	if !found {
+		return "", images.Info{}, false
+	}
+
+	info, err := r.images.Info(filepath.Join(r.contentDir, relPath))
+	if err != nil {
+		return "", images.Info{}, false
+	}
+	return r.url(relPath, false), info, true
+}
+
+// Kinds of media files, which embeds render as players or viewers.
+const (
+	mediaImage = "image"
+	mediaAudio = "audio"
+	mediaVideo = "video"
+	mediaPDF   = "pdf"
+)
+
+// mediaKind returns the kind of media file path is, from its extension, or
+// "" if it is not one.
+func mediaKind(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
 	case ".apng", ".avif", ".gif", ".jpg", ".jpeg", ".jfif", ".pjpeg", ".pjp", ".png", ".svg", ".webp":
-		return true
+		return mediaImage
+	case ".mp3", ".wav", ".m4a", ".ogg", ".oga", ".opus", ".flac", ".aac", ".3gp":
+		return mediaAudio
+	case ".mp4", ".m4v", ".webm", ".ogv", ".mov", ".mkv":
+		return mediaVideo
+	case ".pdf":
+		return mediaPDF
 	}
-	return false
+	return ""
 }
 
 // -----------------------------------------------------------------------------
@@ -286,7 +411,7 @@ func NewWikilinkRenderer(resolver WikilinkResolver) renderer.NodeRenderer {
 func (r *WikilinkRenderer) init() {
 	r.once.Do(func() {
 		if r.Resolver == nil {
-			r.Resolver = NewSlugResolver("content")
+			r.Resolver = NewSlugResolver("content", nil, nil, nil)
 		}
 	})
 }
@@ -320,8 +445,11 @@ func (r *WikilinkRenderer) enter(w util.BufWriter, n *WikilinkNode, src []byte)
 		return gast.WalkContinue, nil
 	}
 
-	img := resolveAsImage(n)
-	if !img {
+	kind := ""
+	if n.Embed {
+		kind = mediaKind(string(n.Target))
+	}
+	if kind == "" {
 		r.hasDest.Store(n, struct{}{})
 		_, _ = w.WriteString(`<a href="`)
 		_, _ = w.Write(util.URLEscape(dest, true))
@@ -329,28 +457,96 @@ func (r *WikilinkRenderer) enter(w util.BufWriter, n *WikilinkNode, src []byte)
 		return gast.WalkContinue, nil
 	}
 
-	_, _ = w.WriteString(`<img src="`)
-	_, _ = w.Write(util.URLEscape(dest, true))
+	label, width, height := embedLabel(n, src)
 
-	var width, height []byte
-
-	if n.ChildCount() == 1 {
-		label := nodeText(src, n.FirstChild())
-
-		labelText := string(label)
-		if isNumeric(labelText) {
-			width = []byte(labelText)
-		} else if parts := strings.Split(labelText, "x"); len(parts) == 2 && isNumeric(parts[0]) && isNumeric(parts[1]) {
-			width = []byte(parts[0])
-			height = []byte(parts[1])
+	switch kind {
+	case mediaAudio:
+		_, _ = w.WriteString(`<audio controls preload="metadata" src="`)
+		_, _ = w.Write(util.URLEscape(dest, true))
+		writeLabel(w, "title", label)
+		_, _ = w.WriteString(`"></audio>`)
+	case mediaVideo:
+		_, _ = w.WriteString(`<video controls preload="metadata" src="`)
+		_, _ = w.Write(util.URLEscape(dest, true))
+		writeLabel(w, "title", label)
+		writeSize(w, width, height)
+		_, _ = w.WriteString(`"></video>`)
+	case mediaPDF:
+		// Browsers' PDF viewers open the page given in the fragment.
+		pdf := util.URLEscape(dest, true)
+		if page := strings.TrimPrefix(string(n.Fragment), "page="); page != string(n.Fragment) && isNumeric(page) {
+			pdf = append(pdf, "#page="+page...)
+		}
+		_, _ = w.WriteString(`<object class="pdf-embed" type="application/pdf" data="`)
+		_, _ = w.Write(pdf)
+		writeLabel(w, "title", label)
+		writeSize(w, width, height)
+		_, _ = w.WriteString(`"><a href="`)
+		_, _ = w.Write(pdf)
+		_, _ = w.WriteString(`" class="internal">`)
+		if label != nil {
+			_, _ = w.Write(util.EscapeHTML(label))
 		} else {
-			if !bytes.Equal(label, n.Target) {
-				_, _ = w.WriteString(`" alt="`)
-				_, _ = w.Write(util.EscapeHTML(label))
+			_, _ = w.Write(util.EscapeHTML(n.Target))
+		}
+		_, _ = w.WriteString(`</a></object>`)
+	default:
+		var srcset, sizes string
+		if imgs, ok := r.Resolver.(ImageResolver); ok {
+			if src, info, ok := imgs.ResolveImage(string(n.Target)); ok {
+				width, height, srcset, sizes = responsiveImage(src, info, width, height)
 			}
 		}
+
+		_, _ = w.WriteString(`<img src="`)
+		_, _ = w.Write(util.URLEscape(dest, true))
+		writeLabel(w, "alt", label)
+		writeSize(w, width, height)
+		_, _ = w.WriteString(`" loading="lazy" decoding="async`)
+		if srcset != "" {
+			_, _ = w.WriteString(`" srcset="`)
+			_, _ = w.Write(util.EscapeHTML([]byte(srcset)))
+			_, _ = w.WriteString(`" sizes="`)
+			_, _ = w.Write(util.EscapeHTML([]byte(sizes)))
+		}
+		_, _ = w.WriteString(`">`)
+	}
+	return gast.WalkSkipChildren, nil
+}
+
+// embedLabel returns the label of an embed, which is its size, as in
+// ![[photo.png|300x200]], or its alternative text.
+func embedLabel(n *WikilinkNode, src []byte) (label, width, height []byte) {
+	if n.ChildCount() != 1 {
+		return nil, nil, nil
+	}
+	label = nodeText(src, n.FirstChild())
+
+	labelText := string(label)
+	if isNumeric(labelText) {
+		return nil, label, nil
+	}
+	if parts := strings.Split(labelText, "x"); len(parts) == 2 && isNumeric(parts[0]) && isNumeric(parts[1]) {
+		return nil, []byte(parts[0]), []byte(parts[1])
+	}
+	if bytes.Equal(label, n.Target) || bytes.HasPrefix(label, []byte(string(n.Target)+"#")) {
+		// Without a label, the text is the target itself.
+		return nil, nil, nil
+	}
+	return label, nil, nil
+}
+
+// writeLabel writes the label of an embed as the attribute name. It and
+// writeSize are written inside the open quotes of the previous attribute.
+func writeLabel(w util.BufWriter, name string, label []byte) {
+	if len(label) == 0 {
+		return
 	}
+	_, _ = w.WriteString(`" ` + name + `="`)
+	_, _ = w.Write(util.EscapeHTML(label))
+}
 
+func writeSize(w util.BufWriter, width, height []byte) {
 	if len(width) > 0 {
 		_, _ = w.WriteString(`" width="`)
 		_, _ = w.Write(width)
@@ -359,28 +555,36 @@ func (r *WikilinkRenderer) enter(w util.BufWriter, n *WikilinkNode, src []byte)
 		_, _ = w.WriteString(`" height="`)
 		_, _ = w.Write(height)
 	}
-
-	_, _ = w.WriteString(`">`)
-	return gast.WalkSkipChildren, nil
 }
 
-func (r *WikilinkRenderer) exit(w util.BufWriter, n *WikilinkNode) {
-	if _, ok := r.hasDest.LoadAndDelete(n); ok {
-		_, _ = w.WriteString("</a>")
+// responsiveImage returns the size, srcset and sizes of the image at src,
+// so that browsers load the smallest variant that fits and reserve the
+// space of the image before it loads. A width or height given by the note
+// is kept and the other follows the aspect ratio of the image.
+func responsiveImage(src string, info images.Info, width, height []byte) (w, h []byte, srcset, sizes string) {
+	w, h = width, height
+	wantWidth, _ := strconv.Atoi(string(width))
+	wantHeight, _ := strconv.Atoi(string(height))
+	switch {
+	case wantWidth == 0 && wantHeight == 0:
+		w, h = []byte(strconv.Itoa(info.Width)), []byte(strconv.Itoa(info.Height))
+	case wantHeight == 0:
+		h = []byte(strconv.Itoa((wantWidth*info.Height + info.Width/2) / info.Width))
+	case wantWidth == 0:
+		w = []byte(strconv.Itoa((wantHeight*info.Width + info.Height/2) / info.Height))
 	}
-}
 
-func resolveAsImage(n *WikilinkNode) bool {
-	if !n.Embed {
-		return false
+	srcset = info.Srcset(string(util.URLEscape([]byte(src), true)))
+	sizes = info.Sizes
+	if wantWidth > 0 {
+		sizes = fmt.Sprintf("(max-width: %dpx) 100vw, %dpx", wantWidth, wantWidth)
 	}
+	return w, h, srcset, sizes
+}
 
-	filename := string(n.Target)
-	switch ext := filepath.Ext(filename); ext {
-	case ".apng", ".avif", ".gif", ".jpg", ".jpeg", ".jfif", ".pjpeg", ".pjp", ".png", ".svg", ".webp":
-		return true
-	default:
-		return false
+func (r *WikilinkRenderer) exit(w util.BufWriter, n *WikilinkNode) {
+	if _, ok := r.hasDest.LoadAndDelete(n); ok {
+		_, _ = w.WriteString("</a>")
 	}
 }
 
@@ -419,9 +623,15 @@ func (e *wikilink) Extend(m goldmark.Markdown) {
 	m.Parser().AddOptions(parser.WithInlineParsers(
 		util.Prioritized(&wikilinkParser{}, 199),
 	))
+	imgs, _ := e.resolver.(ImageResolver)
 	m.Parser().AddOptions(parser.WithASTTransformers(
-		util.Prioritized(&LinkTransformer{}, 100),
+		util.Prioritized(&LinkTransformer{images: imgs}, 100),
 	))
+	if files, ok := e.resolver.(FileResolver); ok {
+		m.Parser().AddOptions(parser.WithASTTransformers(
+			util.Prioritized(&includeTransformer{files: files}, 110),
+		))
+	}
 	m.Renderer().AddOptions(renderer.WithNodeRenderers(
 		util.Prioritized(NewWikilinkRenderer(e.resolver), 199),
 	))
@@ -431,7 +641,9 @@ func (e *wikilink) Extend(m goldmark.Markdown) {
 // Transformer
 // -----------------------------------------------------------------------------
 
-type LinkTransformer struct{}
+type LinkTransformer struct {
+	images ImageResolver
+}
 
 func (t *LinkTransformer) Transform(node *gast.Document, reader text.Reader, pc parser.Context) {
 	source := reader.Source()
@@ -445,6 +657,11 @@ func (t *LinkTransformer) Transform(node *gast.Document, reader text.Reader, pc
 			processLink(n)
 		case *gast.Image:
 			processImage(n, source)
+			n.SetAttributeString("loading", []byte("lazy"))
+			n.SetAttributeString("decoding", []byte("async"))
+			if t.images != nil && !isExternal(string(n.Destination)) {
+				setResponsive(n, t.images)
+			}
 		}
 		return gast.WalkContinue, nil
 	})
@@ -486,6 +703,33 @@ func processImage(n *gast.Image, source []byte) {
 	}
 }
 
+// setResponsive gives an image of the vault its size and srcset, like the
+// images embedded with wikilinks.
+func setResponsive(n *gast.Image, resolver ImageResolver) {
+	src, info, ok := resolver.ResolveImage(string(n.Destination))
+	if !ok {
+		return
+	}
+
+	width, height := imageAttribute(n, "width"), imageAttribute(n, "height")
+	width, height, srcset, sizes := responsiveImage(src, info, width, height)
+	n.SetAttributeString("width", width)
+	n.SetAttributeString("height", height)
+	if srcset != "" {
+		n.SetAttributeString("srcset", []byte(srcset))
+		n.SetAttributeString("sizes", []byte(sizes))
+	}
+}
+
+func imageAttribute(n *gast.Image, name string) []byte {
+	if v, ok := n.AttributeString(name); ok {
+		if b, ok := v.([]byte); ok {
+			return b
+		}
+	}
+	return nil
+}
+
 func parseImageSize(n *gast.Image, size string) bool {
 	parts := strings.Split(size, "x")
 	if len(parts) == 1 {
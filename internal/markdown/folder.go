@@ -0,0 +1,143 @@
+package markdown
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+
+	meta "github.com/yuin/goldmark-meta"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+	"gopkg.in/yaml.v2"
+)
+
+// FolderDefaultsFile sets metadata for every file in its folder and the
+// folders below it. It configures the folder and is not part of the site.
+const FolderDefaultsFile = "_folder.yml"
+
+// CascadeKey is the frontmatter key of a folder's index.md that holds
+// metadata for every file in the folder, like a _folder.yml.
+const CascadeKey = "cascade"
+
+// FolderDefaults resolves the metadata folders set for their files. Defaults
+// cascade down the tree: a folder's _folder.yml, then the cascade of its
+// index.md, override those of the folders above it, and a file's own
+// frontmatter overrides them all.
+type FolderDefaults struct {
+	contentDir string
+
+	mu      sync.Mutex
+	folders map[string]map[string]string
+}
+
+func NewFolderDefaults(contentDir string) *FolderDefaults {
+	return &FolderDefaults{
+		contentDir: contentDir,
+		folders:    make(map[string]map[string]string),
+	}
+}
+
+// Apply adds the defaults of the folders containing relPath, a path relative
+// to the content directory, to metadata. Keys metadata already has are kept.
+func (f *FolderDefaults) Apply(relPath string, metadata map[string]string) error {
+	defaults, err := f.defaults(filepath.Dir(relPath))
+	if err != nil {
+		return err
+	}
+
+	for key, value := range defaults {
+		if _, ok := metadata[key]; !ok {
+			metadata[key] = value
+		}
+	}
+	return nil
+}
+
+func (f *FolderDefaults) defaults(dir string) (map[string]string, error) {
+	f.mu.Lock()
+	cached, ok := f.folders[dir]
+	f.mu.Unlock()
+	if ok {
+		return cached, nil
+	}
+
+	defaults := make(map[string]string)
+	if dir != "." {
+		inherited, err := f.defaults(filepath.Dir(dir))
+		if err != nil {
+			return nil, err
+		}
+		for key, value := range inherited {
+			defaults[key] = value
+		}
+	}
+
+	if err := f.load(dir, defaults); err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	f.folders[dir] = defaults
+	f.mu.Unlock()
+	return defaults, nil
+}
+
+// load adds the defaults set by dir itself.
+func (f *FolderDefaults) load(dir string, defaults map[string]string) error {
+	folderPath := filepath.Join(f.contentDir, dir, FolderDefaultsFile)
+	content, err := os.ReadFile(folderPath)
+	switch {
+	case err == nil:
+		var values map[string]interface{}
+		if err := yaml.Unmarshal(content, &values); err != nil {
+			return fmt.Errorf("invalid %s: %w", folderPath, err)
+		}
+		for key, value := range convertMetadata(values) {
+			defaults[key] = value
+		}
+	case !errors.Is(err, fs.ErrNotExist):
+		return err
+	}
+
+	indexPath := filepath.Join(f.contentDir, dir, "index.md")
+	content, err = os.ReadFile(indexPath)
+	switch {
+	case err == nil:
+		cascade, err := extractCascade(content)
+		if err != nil {
+			return fmt.Errorf("invalid %s in %s: %w", CascadeKey, indexPath, err)
+		}
+		for key, value := range cascade {
+			defaults[key] = value
+		}
+	case !errors.Is(err, fs.ErrNotExist):
+		return err
+	}
+
+	return nil
+}
+
+// extractCascade returns the cascade map of a note's frontmatter.
+func extractCascade(content []byte) (map[string]string, error) {
+	ctx := parser.NewContext()
+	_ = frontmatterParser.Parser().Parse(text.NewReader(content), parser.WithContext(ctx))
+
+	value, ok := meta.Get(ctx)[CascadeKey]
+	if !ok {
+		return nil, nil
+	}
+
+	values, ok := value.(map[interface{}]interface{})
+	if !ok {
+		return nil, fmt.Errorf("expected a map, got %v", value)
+	}
+
+	cascade := make(map[string]string, len(values))
+	for key, value := range values {
+		cascade[fmt.Sprint(key)] = fmt.Sprint(value)
+	}
+	return cascade, nil
+}
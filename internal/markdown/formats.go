@@ -0,0 +1,91 @@
+package markdown
+
+import (
+	"html"
+	"regexp"
+
+	"blaze/internal/config"
+	"blaze/internal/datatable"
+	"blaze/internal/markdown/extensions"
+)
+
+// Pages can be written in formats other than Markdown. Like notes, files in
+// the text formats may start with frontmatter, which is the metadata of the
+// page, and take the defaults of their folder.
+
+// reBody matches the body of a complete HTML document.
+var reBody = regexp.MustCompile(`(?is)<body[^>]*>(.*)</body>`)
+
+// HTMLTransformer renders .html files, fragments of a page, in the layout.
+// Their HTML goes through the rawHTML option like raw HTML in notes.
+type HTMLTransformer struct {
+	rawHTML string
+}
+
+func NewHTMLTransformer(cfg *config.Config) *HTMLTransformer {
+	return &HTMLTransformer{rawHTML: cfg.RawHTML}
+}
+
+func (t *HTMLTransformer) Name() string {
+	return "html"
+}
+
+func (t *HTMLTransformer) Transform(content []byte) (string, map[string]string, error) {
+	metadata, body := ExtractFrontmatter(string(content))
+
+	// Of a complete document, only the body goes in the layout.
+	if m := reBody.FindStringSubmatch(body); m != nil {
+		body = m[1]
+	}
+
+	filtered, modified := extensions.FilterHTML(t.rawHTML, []byte(body))
+	if modified {
+		metadata["_rawHTMLModified"] = "true"
+	}
+	return string(filtered), metadata, nil
+}
+
+// TextTransformer renders .txt files as preformatted text.
+type TextTransformer struct{}
+
+func NewTextTransformer() *TextTransformer {
+	return &TextTransformer{}
+}
+
+func (t *TextTransformer) Name() string {
+	return "text"
+}
+
+func (t *TextTransformer) Transform(content []byte) (string, map[string]string, error) {
+	metadata, body := ExtractFrontmatter(string(content))
+	return `<pre class="plain-text">` + html.EscapeString(body) + "</pre>\n", metadata, nil
+}
+
+// TableTransformer renders .csv and .tsv files as a table that readers can
+// sort by a column.
+type TableTransformer struct {
+	comma rune
+}
+
+// NewTableTransformer reads values separated by comma: ',' for CSV and '\t'
+// for TSV.
+func NewTableTransformer(comma rune) *TableTransformer {
+	return &TableTransformer{comma: comma}
+}
+
+func (t *TableTransformer) Name() string {
+	return "table"
+}
+
+func (t *TableTransformer) Transform(content []byte) (string, map[string]string, error) {
+	metadata, body := ExtractFrontmatter(string(content))
+	table, err := datatable.Parse([]byte(body), t.comma)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if len(table.Rows) > 1 {
+		metadata["hasSortable"] = "true"
+	}
+	return table.HTML(len(table.Rows) > 1), metadata, nil
+}
@@ -0,0 +1,355 @@
+package highlighting
+
+import (
+	"bytes"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+)
+
+var titleAttrName = []byte("title")
+var insLinesAttrName = []byte("ins")
+var delLinesAttrName = []byte("del")
+
+// diffLanguagePrefix turns on diff mode: ```diff-go highlights Go and marks
+// the lines starting with + or - as inserted or deleted.
+const diffLanguagePrefix = "diff-"
+
+// Classes added to the lines of a code block.
+const (
+	insertedLineClass = "ins"
+	deletedLineClass  = "del"
+)
+
+// annotationsClass is the class of the list explaining the annotation
+// markers of the code block before it.
+var annotationsClass = []byte("code-annotations")
+
+// reTitle matches title="..." in the info string, outside the attributes.
+var reTitle = regexp.MustCompile(`(?:^|\s)title=(?:"([^"]*)"|'([^']*)'|(\S+))`)
+
+// annotationComments are the comments annotation markers are written in, by
+// the name chroma gives the language. Code in other languages has no markers.
+var annotationComments = []struct {
+	open, close string
+	languages   []string
+}{
+	{"//", "", []string{
+		"c", "c#", "c++", "d", "dart", "go", "groovy", "java", "javascript", "kotlin", "objective-c",
+		"php", "protocol buffer", "react", "rust", "sass", "scala", "scss", "solidity", "swift", "typescript", "zig",
+	}},
+	{"#", "", []string{
+		"awk", "bash", "cmake", "coffeescript", "crystal", "docker", "elixir", "fish", "gas", "graphql", "hcl",
+		"julia", "makefile", "nginx configuration file", "nim", "nix", "perl", "powershell", "python", "r",
+		"ruby", "tcl", "terraform", "toml", "yaml",
+	}},
+	{"--", "", []string{"ada", "elm", "haskell", "lua", "sql", "vhdl"}},
+	{";", "", []string{"clojure", "common lisp", "ini", "nasm", "racket", "scheme"}},
+	{"%", "", []string{"erlang", "matlab", "prolog", "tex"}},
+	{"/*", "*/", []string{"css"}},
+	{"<!--", "-->", []string{"html", "markdown", "vue", "xml"}},
+}
+
+// annotationPatterns match an annotation marker at the end of a line, by
+// language: a comment holding only a number in parentheses, such as // (1)
+// in Go or # (2) in Python.
+var annotationPatterns = func() map[string]*regexp.Regexp {
+	patterns := make(map[string]*regexp.Regexp)
+	for _, c := range annotationComments {
+		pattern := `(?:^|\s)` + regexp.QuoteMeta(c.open) + `\s*\((\d+)\)\s*`
+		if c.close != "" {
+			pattern += regexp.QuoteMeta(c.close) + `\s*`
+		}
+		re := regexp.MustCompile(pattern + `$`)
+		for _, language := range c.languages {
+			patterns[language] = re
+		}
+	}
+	return patterns
+}()
+
+// annotationPattern returns the pattern of the annotation markers of code in
+// language, or nil if the language is unknown.
+func annotationPattern(language []byte) *regexp.Regexp {
+	language, _ = splitDiff(language)
+	lexer := lexers.Get(string(language))
+	if lexer == nil {
+		return nil
+	}
+	return annotationPatterns[strings.ToLower(lexer.Config().Name)]
+}
+
+// splitDiff returns the language of the code in a code block and whether the
+// block is in diff mode.
+func splitDiff(language []byte) ([]byte, bool) {
+	if bytes.HasPrefix(language, []byte(diffLanguagePrefix)) && len(language) > len(diffLanguagePrefix) {
+		return language[len(diffLanguagePrefix):], true
+	}
+	return language, false
+}
+
+// blockTitle returns the title of a code block, given as title="..." in its
+// info string or its attributes.
+func blockTitle(info []byte, attrs ImmutableAttributes) string {
+	if attrs != nil {
+		if v, ok := attrs.Get(titleAttrName); ok {
+			if title, ok := v.([]byte); ok {
+				return string(title)
+			}
+		}
+	}
+
+	if i := bytes.IndexByte(info, '{'); i >= 0 {
+		info = info[:i]
+	}
+	m := reTitle.FindSubmatch(info)
+	if m == nil {
+		return ""
+	}
+	return string(bytes.Join(m[1:], nil))
+}
+
+// lineRanges parses the line numbers and "from-to" ranges given to
+// hl_lines, ins and del, either as a single value, as in ins=2 or
+// del="3-4", or as a list, as in ins=[2, "5-7"].
+func lineRanges(value interface{}) [][2]int {
+	items, ok := value.([]interface{})
+	if !ok {
+		items = []interface{}{value}
+	}
+
+	var ranges [][2]int
+	for _, item := range items {
+		if ln, ok := item.(float64); ok {
+			ranges = append(ranges, [2]int{int(ln), int(ln)})
+		}
+		if rng, ok := item.([]uint8); ok {
+			slices := strings.Split(string([]byte(rng)), "-")
+			lhs, err := strconv.Atoi(strings.TrimSpace(slices[0]))
+			if err != nil {
+				continue
+			}
+			rhs := lhs
+			if len(slices) > 1 {
+				rhs, err = strconv.Atoi(strings.TrimSpace(slices[1]))
+				if err != nil {
+					continue
+				}
+			}
+			ranges = append(ranges, [2]int{lhs, rhs})
+		}
+	}
+	return ranges
+}
+
+// lineDecorations are the classes and annotation markers added to the lines
+// of a highlighted code block, by line number starting at 1.
+type lineDecorations struct {
+	classes     map[int]string
+	annotations map[int]string
+}
+
+func (d *lineDecorations) empty() bool {
+	return len(d.classes) == 0 && len(d.annotations) == 0
+}
+
+func (d *lineDecorations) addClass(line int, class string) {
+	if d.classes == nil {
+		d.classes = make(map[int]string)
+	}
+	d.classes[line] = class
+}
+
+// markRanges adds class to the lines listed in the attribute name.
+func (d *lineDecorations) markRanges(attrs ImmutableAttributes, name []byte, class string) {
+	if attrs == nil {
+		return
+	}
+	v, ok := attrs.Get(name)
+	if !ok {
+		return
+	}
+	for _, r := range lineRanges(v) {
+		for line := r[0]; line <= r[1]; line++ {
+			d.addClass(line, class)
+		}
+	}
+}
+
+// prepareLines removes the diff markers and the annotation markers matched by
+// annotations, if not nil, from code. They are rendered by decorate instead.
+func prepareLines(code string, diff bool, annotations *regexp.Regexp) (string, lineDecorations) {
+	var d lineDecorations
+	lines := strings.SplitAfter(code, "\n")
+
+	// Unified diffs also prefix unchanged lines, with a space.
+	unified := diff
+	for _, line := range lines {
+		if strings.TrimSpace(line) != "" && !strings.ContainsAny(line[:1], "+- ") {
+			unified = false
+		}
+	}
+
+	var b strings.Builder
+	for i, line := range lines {
+		if diff && line != "" {
+			switch {
+			case line[0] == '+':
+				d.addClass(i+1, insertedLineClass)
+				line = line[1:]
+			case line[0] == '-':
+				d.addClass(i+1, deletedLineClass)
+				line = line[1:]
+			case line[0] == ' ' && unified:
+				line = line[1:]
+			}
+		}
+
+		if annotations != nil {
+			content := strings.TrimSuffix(line, "\n")
+			if loc := annotations.FindStringSubmatchIndex(content); loc != nil {
+				if d.annotations == nil {
+					d.annotations = make(map[int]string)
+				}
+				d.annotations[i+1] = content[loc[2]:loc[3]]
+				line = strings.TrimRight(content[:loc[0]], " \t") + line[len(content):]
+			}
+		}
+
+		b.WriteString(line)
+	}
+	return b.String(), d
+}
+
+var lineStart = []byte(`<span class="line`)
+
+// decorate adds the line classes and annotation markers of d to the HTML
+// of a code block written by chroma, which wraps each line in a span.
+func decorate(highlighted []byte, d lineDecorations) []byte {
+	if d.empty() {
+		return highlighted
+	}
+
+	parts := bytes.Split(highlighted, lineStart)
+
+	var out bytes.Buffer
+	out.Write(parts[0])
+	for i, rest := range parts[1:] {
+		line := i + 1
+		out.Write(lineStart)
+		if class, ok := d.classes[line]; ok {
+			out.WriteString(" " + class)
+		}
+
+		// Tokens are escaped, so the first line break ends the line.
+		end := bytes.IndexByte(rest, '\n')
+		annotation := d.annotations[line]
+		if annotation == "" || end < 0 {
+			out.Write(rest)
+			continue
+		}
+		out.Write(rest[:end])
+		out.WriteString(`<span class="code-annotation">` + annotation + `</span>`)
+		out.Write(rest[end:])
+	}
+	return out.Bytes()
+}
+
+// annotationTransformer styles the ordered list right after a code block
+// with annotation markers as the legend of the markers. Only code blocks
+// followed by such a list show their markers; in others, a comment like
+// // (1) is left as code.
+type annotationTransformer struct{}
+
+func (t *annotationTransformer) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	source := reader.Source()
+
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		var language, code []byte
+		switch block := n.(type) {
+		case *ast.FencedCodeBlock:
+			language = block.Language(source)
+			code = codeLines(block, source)
+		case *SourceCode:
+			language, code = block.Language, block.Code
+		default:
+			return ast.WalkContinue, nil
+		}
+
+		language, _ = splitDiff(language)
+		list, ok := n.NextSibling().(*ast.List)
+		if !ok || !list.IsOrdered() || !hasAnnotations(code, annotationPattern(language)) {
+			return ast.WalkSkipChildren, nil
+		}
+		list.SetAttributeString("class", annotationsClass)
+		return ast.WalkSkipChildren, nil
+	})
+}
+
+// hasLegend reports whether the list after the code block n was styled as
+// the legend of its annotation markers.
+func hasLegend(n ast.Node) bool {
+	list, ok := n.NextSibling().(*ast.List)
+	if !ok {
+		return false
+	}
+	class, ok := list.AttributeString("class")
+	value, _ := class.([]byte)
+	return ok && bytes.Equal(value, annotationsClass)
+}
+
+// codeLines returns the code of a fenced code block.
+func codeLines(block *ast.FencedCodeBlock, source []byte) []byte {
+	var code []byte
+	lines := block.Lines()
+	for i := 0; i < lines.Len(); i++ {
+		segment := lines.At(i)
+		code = append(code, segment.Value(source)...)
+	}
+	return code
+}
+
+func hasAnnotations(code []byte, annotations *regexp.Regexp) bool {
+	if annotations == nil {
+		return false
+	}
+	for _, line := range bytes.Split(code, []byte("\n")) {
+		if annotations.Match(line) {
+			return true
+		}
+	}
+	return false
+}
+
+// SourceCode is a code block whose code does not come from the document,
+// such as a file embedded in a note. It is rendered like a fenced code block
+// with the same attributes.
+type SourceCode struct {
+	ast.BaseBlock
+	Language []byte
+	Code     []byte
+	// Title is shown above the code unless a title attribute is set.
+	Title string
+}
+
+var KindSourceCode = ast.NewNodeKind("SourceCode")
+
+func (n *SourceCode) Kind() ast.NodeKind {
+	return KindSourceCode
+}
+
+func (n *SourceCode) IsRaw() bool {
+	return true
+}
+
+func (n *SourceCode) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, nil, nil)
+}
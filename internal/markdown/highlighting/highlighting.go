@@ -3,7 +3,7 @@ package highlighting
 import (
 	"bytes"
 	"io"
-	"strconv"
+	"regexp"
 	"strings"
 
 	"github.com/yuin/goldmark"
@@ -358,6 +358,7 @@ func NewHTMLRenderer(opts ...Option) renderer.NodeRenderer {
 // RegisterFuncs implements NodeRenderer.RegisterFuncs.
 func (r *HTMLRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
 	reg.Register(ast.KindFencedCodeBlock, r.renderFencedCodeBlock)
+	reg.Register(KindSourceCode, r.renderSourceCode)
 }
 
 func getAttributes(node *ast.FencedCodeBlock, infostr []byte) ImmutableAttributes {
@@ -392,7 +393,42 @@ func (r *HTMLRenderer) renderFencedCodeBlock(w util.BufWriter, source []byte, no
 	if !entering {
 		return ast.WalkContinue, nil
 	}
-	language := n.Language(source)
+
+	var info []byte
+	if n.Info != nil {
+		info = n.Info.Segment.Value(source)
+	}
+	attrs := getAttributes(n, info)
+
+	r.renderCode(w, n.Language(source), codeLines(n, source), attrs, blockTitle(info, attrs), hasLegend(n))
+	return ast.WalkContinue, nil
+}
+
+func (r *HTMLRenderer) renderSourceCode(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	n := node.(*SourceCode)
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+
+	var attrs ImmutableAttributes
+	if n.Attributes() != nil {
+		attrs = &immutableAttributes{n}
+	}
+	title := blockTitle(nil, attrs)
+	if title == "" {
+		title = n.Title
+	}
+
+	r.renderCode(w, n.Language, n.Code, attrs, title, hasLegend(n))
+	return ast.WalkContinue, nil
+}
+
+// renderCode writes a code block, highlighted unless its language is
+// unknown and cannot be guessed or the nohl attribute is set. The annotation
+// markers of an annotated block are shown as markers.
+func (r *HTMLRenderer) renderCode(w util.BufWriter, language, rawCode []byte, attrs ImmutableAttributes, title string, annotated bool) {
+	blockLanguage := language
+	language, diff := splitDiff(language)
 
 	chromaFormatterOptions := make([]chromahtml.Option, len(r.FormatOptions))
 	copy(chromaFormatterOptions, r.FormatOptions)
@@ -403,11 +439,6 @@ func (r *HTMLRenderer) renderFencedCodeBlock(w util.BufWriter, source []byte, no
 	}
 	nohl := false
 
-	var info []byte
-	if n.Info != nil {
-		info = n.Info.Segment.Value(source)
-	}
-	attrs := getAttributes(n, info)
 	if attrs != nil {
 		baseLineNumber := 1
 		if linenostartAttr, ok := attrs.Get(linenostartAttrName); ok {
@@ -417,30 +448,11 @@ func (r *HTMLRenderer) renderFencedCodeBlock(w util.BufWriter, source []byte, no
 			}
 		}
 		if linesAttr, hasLinesAttr := attrs.Get(highlightLinesAttrName); hasLinesAttr {
-			if lines, ok := linesAttr.([]interface{}); ok {
-				var hlRanges [][2]int
-				for _, l := range lines {
-					if ln, ok := l.(float64); ok {
-						hlRanges = append(hlRanges, [2]int{int(ln) + baseLineNumber - 1, int(ln) + baseLineNumber - 1})
-					}
-					if rng, ok := l.([]uint8); ok {
-						slices := strings.Split(string([]byte(rng)), "-")
-						lhs, err := strconv.Atoi(slices[0])
-						if err != nil {
-							continue
-						}
-						rhs := lhs
-						if len(slices) > 1 {
-							rhs, err = strconv.Atoi(slices[1])
-							if err != nil {
-								continue
-							}
-						}
-						hlRanges = append(hlRanges, [2]int{lhs + baseLineNumber - 1, rhs + baseLineNumber - 1})
-					}
-				}
-				chromaFormatterOptions = append(chromaFormatterOptions, chromahtml.HighlightLines(hlRanges))
+			var hlRanges [][2]int
+			for _, r := range lineRanges(linesAttr) {
+				hlRanges = append(hlRanges, [2]int{r[0] + baseLineNumber - 1, r[1] + baseLineNumber - 1})
 			}
+			chromaFormatterOptions = append(chromaFormatterOptions, chromahtml.HighlightLines(hlRanges))
 		}
 		if styleAttr, hasStyleAttr := attrs.Get(styleAttrName); hasStyleAttr {
 			if st, ok := styleAttr.([]uint8); ok {
@@ -477,15 +489,16 @@ func (r *HTMLRenderer) renderFencedCodeBlock(w util.BufWriter, source []byte, no
 		if style == nil {
 			style = styles.Fallback
 		}
-		var buffer bytes.Buffer
-		l := n.Lines().Len()
-		for i := 0; i < l; i++ {
-			line := n.Lines().At(i)
-			buffer.Write(line.Value(source))
+		var annotations *regexp.Regexp
+		if annotated {
+			annotations = annotationPattern(language)
 		}
+		code, decorations := prepareLines(string(rawCode), diff, annotations)
+		decorations.markRanges(attrs, insLinesAttrName, insertedLineClass)
+		decorations.markRanges(attrs, delLinesAttrName, deletedLineClass)
 
 		if lexer == nil {
-			lexer = lexers.Analyse(buffer.String())
+			lexer = lexers.Analyse(code)
 			if lexer == nil {
 				lexer = lexers.Fallback
 			}
@@ -493,7 +506,7 @@ func (r *HTMLRenderer) renderFencedCodeBlock(w util.BufWriter, source []byte, no
 		}
 		lexer = chroma.Coalesce(lexer)
 
-		iterator, err := lexer.Tokenise(nil, buffer.String())
+		iterator, err := lexer.Tokenise(nil, code)
 		if err == nil {
 			c := newCodeBlockContext(language, true, attrs)
 
@@ -501,45 +514,73 @@ func (r *HTMLRenderer) renderFencedCodeBlock(w util.BufWriter, source []byte, no
 				chromaFormatterOptions = append(chromaFormatterOptions, r.CodeBlockOptions(c)...)
 			}
 			formatter := chromahtml.New(chromaFormatterOptions...)
+			marked := diff || len(decorations.classes) > 0
+			r.openCodeBlock(w, title, marked)
 			if r.WrapperRenderer != nil {
 				r.WrapperRenderer(w, c, true)
 			}
-			_ = formatter.Format(w, style, iterator) == nil
+			var highlighted bytes.Buffer
+			_ = formatter.Format(&highlighted, style, iterator) == nil
+			_, _ = w.Write(decorate(highlighted.Bytes(), decorations))
 			if r.WrapperRenderer != nil {
 				r.WrapperRenderer(w, c, false)
 			}
+			r.closeCodeBlock(w, title, marked)
 			if r.CSSWriter != nil {
 				_ = formatter.WriteCSS(r.CSSWriter, style)
 			}
-			return ast.WalkContinue, nil
+			return
 		}
 	}
 
+	r.openCodeBlock(w, title, false)
+
 	var c CodeBlockContext
 	if r.WrapperRenderer != nil {
 		c = newCodeBlockContext(language, false, attrs)
 		r.WrapperRenderer(w, c, true)
 	} else {
 		_, _ = w.WriteString("<pre><code")
-		language := n.Language(source)
-		if language != nil {
+		if blockLanguage != nil {
 			_, _ = w.WriteString(" class=\"language-")
-			r.Writer.Write(w, language)
+			r.Writer.Write(w, blockLanguage)
 			_, _ = w.WriteString("\"")
 		}
 		_ = w.WriteByte('>')
 	}
-	l := n.Lines().Len()
-	for i := 0; i < l; i++ {
-		line := n.Lines().At(i)
-		r.Writer.RawWrite(w, line.Value(source))
-	}
+	r.Writer.RawWrite(w, rawCode)
 	if r.WrapperRenderer != nil {
 		r.WrapperRenderer(w, c, false)
 	} else {
 		_, _ = w.WriteString("</code></pre>\n")
 	}
-	return ast.WalkContinue, nil
+	r.closeCodeBlock(w, title, false)
+}
+
+// openCodeBlock wraps code blocks that have a title or marked lines in a
+// div, with the title as its first child.
+func (r *HTMLRenderer) openCodeBlock(w util.BufWriter, title string, marked bool) {
+	if title == "" && !marked {
+		return
+	}
+
+	_, _ = w.WriteString(`<div class="code-block`)
+	if marked {
+		_, _ = w.WriteString(` diff`)
+	}
+	_, _ = w.WriteString(`">`)
+	if title != "" {
+		_, _ = w.WriteString(`<div class="code-title">`)
+		_, _ = w.Write(util.EscapeHTML([]byte(title)))
+		_, _ = w.WriteString(`</div>`)
+	}
+}
+
+func (r *HTMLRenderer) closeCodeBlock(w util.BufWriter, title string, marked bool) {
+	if title == "" && !marked {
+		return
+	}
+	_, _ = w.WriteString("</div>\n")
 }
 
 type highlighting struct {
@@ -560,6 +601,9 @@ func NewHighlighting(opts ...Option) goldmark.Extender {
 
 // Extend implements goldmark.Extender.
 func (e *highlighting) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(parser.WithASTTransformers(
+		util.Prioritized(&annotationTransformer{}, 200),
+	))
 	m.Renderer().AddOptions(renderer.WithNodeRenderers(
 		util.Prioritized(NewHTMLRenderer(e.options...), 200),
 	))
@@ -0,0 +1,55 @@
+package highlighting
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/alecthomas/chroma/v2"
+	chromahtml "github.com/alecthomas/chroma/v2/formatters/html"
+)
+
+// WriteThemeCSS writes the stylesheet for code highlighted with classes in
+// a light and a dark style. The reader's color scheme preference picks one.
+// Each style is in its own media query so that neither leaks token colors
+// the other leaves undefined.
+func WriteThemeCSS(w io.Writer, light, dark *chroma.Style, opts ...chromahtml.Option) error {
+	formatter := chromahtml.New(append([]chromahtml.Option{chromahtml.WithClasses(true)}, opts...)...)
+
+	themes := []struct {
+		name  string
+		style *chroma.Style
+	}{
+		{"light", light},
+		{"dark", dark},
+	}
+
+	for i, theme := range themes {
+		var css bytes.Buffer
+		if err := formatter.WriteCSS(&css, theme.style); err != nil {
+			return err
+		}
+
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "/* %s theme (%s) */\n", strings.ToUpper(theme.name[:1])+theme.name[1:], theme.style.Name)
+		fmt.Fprintf(w, "@media (prefers-color-scheme: %s) {\n", theme.name)
+		writeIndented(w, css.Bytes(), "  ")
+		fmt.Fprintln(w, "}")
+	}
+	return nil
+}
+
+// writeIndented writes the rules of css, as written by chroma one per line,
+// indented inside a media query.
+func writeIndented(w io.Writer, css []byte, indent string) {
+	scanner := bufio.NewScanner(bytes.NewReader(css))
+	for scanner.Scan() {
+		if line := scanner.Text(); line != "" {
+			fmt.Fprintf(w, "%s%s\n", indent, line)
+		}
+	}
+}
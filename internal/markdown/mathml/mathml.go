@@ -0,0 +1,852 @@
+// Package mathml converts TeX math to MathML, so formulas render without
+// JavaScript. It covers the common subset of LaTeX math: fractions, roots,
+// scripts, Greek letters, operators, accents, delimiters, font commands and
+// the matrix, cases and aligned environments. Anything else is reported as
+// an *UnsupportedError, so callers can fall back to rendering in the browser.
+package mathml
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// UnsupportedError reports a TeX construct the converter does not cover.
+type UnsupportedError struct {
+	Construct string
+}
+
+func (e *UnsupportedError) Error() string {
+	return "unsupported TeX: " + e.Construct
+}
+
+func unsupported(format string, args ...any) error {
+	return &UnsupportedError{Construct: fmt.Sprintf(format, args...)}
+}
+
+// Render converts tex to a <math> element, displayed as a block if display is
+// set. The TeX source is kept as an annotation.
+func Render(tex string, display bool) (string, error) {
+	p := &parser{src: []rune(tex), display: display}
+
+	body, err := p.parseList()
+	if err != nil {
+		return "", err
+	}
+	if t := p.peek(); t.kind != tokenEOF {
+		return "", unsupported("%s", t)
+	}
+
+	var b strings.Builder
+	b.WriteString(`<math xmlns="http://www.w3.org/1998/Math/MathML"`)
+	if display {
+		b.WriteString(` display="block"`)
+	}
+	b.WriteString(`><semantics>`)
+	b.WriteString(row(body))
+	b.WriteString(`<annotation encoding="application/x-tex">`)
+	b.WriteString(html.EscapeString(strings.TrimSpace(tex)))
+	b.WriteString(`</annotation></semantics></math>`)
+	return b.String(), nil
+}
+
+// -----------------------------------------------------------------------------
+// Lexer
+// -----------------------------------------------------------------------------
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	// tokenCommand is a backslash command; value is its name.
+	tokenCommand
+	// tokenChar is any other character.
+	tokenChar
+)
+
+type token struct {
+	kind  tokenKind
+	value string
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokenEOF:
+		return "end of input"
+	case tokenCommand:
+		return `\` + t.value
+	}
+	return t.value
+}
+
+func (t token) is(kind tokenKind, value string) bool {
+	return t.kind == kind && t.value == value
+}
+
+type parser struct {
+	src     []rune
+	pos     int
+	display bool
+	// variant is the alphabet set by an enclosing font command.
+	variant string
+}
+
+func (p *parser) skipSpace() {
+	for p.pos < len(p.src) && unicode.IsSpace(p.src[p.pos]) {
+		p.pos++
+	}
+}
+
+// next returns the next token, skipping whitespace, which is insignificant
+// in math mode.
+func (p *parser) next() token {
+	p.skipSpace()
+	if p.pos >= len(p.src) {
+		return token{kind: tokenEOF}
+	}
+
+	r := p.src[p.pos]
+	p.pos++
+	if r != '\\' {
+		return token{kind: tokenChar, value: string(r)}
+	}
+
+	if p.pos >= len(p.src) {
+		return token{kind: tokenChar, value: `\`}
+	}
+
+	start := p.pos
+	for p.pos < len(p.src) && isLetter(p.src[p.pos]) {
+		p.pos++
+	}
+	if p.pos == start {
+		// A control symbol such as \, or \{.
+		p.pos++
+	}
+	return token{kind: tokenCommand, value: string(p.src[start:p.pos])}
+}
+
+func (p *parser) peek() token {
+	pos := p.pos
+	t := p.next()
+	p.pos = pos
+	return t
+}
+
+func isLetter(r rune) bool {
+	return r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z'
+}
+
+// rawGroup reads a {...} argument as text, for \text and environment names.
+func (p *parser) rawGroup() (string, error) {
+	if t := p.next(); !t.is(tokenChar, "{") {
+		return "", unsupported("%s without a braced argument", t)
+	}
+
+	start := p.pos
+	depth := 1
+	for ; p.pos < len(p.src); p.pos++ {
+		switch p.src[p.pos] {
+		case '\\':
+			p.pos++
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				text := string(p.src[start:p.pos])
+				p.pos++
+				return text, nil
+			}
+		}
+	}
+	return "", unsupported("unbalanced braces")
+}
+
+// -----------------------------------------------------------------------------
+// Parser
+// -----------------------------------------------------------------------------
+
+// parseList parses atoms up to the end of the input or of the enclosing
+// group, cell or \left ... \right pair. The caller consumes the token that
+// ended the list.
+func (p *parser) parseList() ([]string, error) {
+	var nodes []string
+	for {
+		t := p.peek()
+		switch {
+		case t.kind == tokenEOF,
+			t.is(tokenChar, "}"), t.is(tokenChar, "&"),
+			t.is(tokenCommand, `\`), t.is(tokenCommand, "cr"),
+			t.is(tokenCommand, "right"), t.is(tokenCommand, "middle"),
+			t.is(tokenCommand, "end"):
+			return nodes, nil
+		case t.is(tokenCommand, "displaystyle"), t.is(tokenCommand, "textstyle"):
+			// Style switches apply to the rest of the list.
+			p.next()
+			rest, err := p.parseList()
+			if err != nil {
+				return nil, err
+			}
+			nodes = append(nodes, fmt.Sprintf(`<mstyle displaystyle="%t">%s</mstyle>`, t.value == "displaystyle", row(rest)))
+			return nodes, nil
+		}
+
+		node, err := p.parseScripted()
+		if err != nil {
+			return nil, err
+		}
+		if node != "" {
+			nodes = append(nodes, node)
+		}
+	}
+}
+
+// atom is a parsed element and how scripts attach to it.
+type atom struct {
+	node string
+	// limits places scripts above and below instead of to the side.
+	limits bool
+	// function is an operator name such as sin, followed by the invisible
+	// function application operator once its scripts are attached.
+	function bool
+}
+
+// parseScripted parses an atom with its subscript, superscript and primes.
+func (p *parser) parseScripted() (string, error) {
+	t := p.peek()
+	var base atom
+	if t.is(tokenChar, "^") || t.is(tokenChar, "_") {
+		base = atom{node: "<mrow></mrow>"}
+	} else {
+		var err error
+		base, err = p.parseAtom()
+		if err != nil {
+			return "", err
+		}
+		if base.node == "" {
+			return "", nil
+		}
+	}
+
+	var sub, sup string
+	primes := ""
+	for {
+		t := p.peek()
+		switch {
+		case t.is(tokenCommand, "limits"):
+			p.next()
+			base.limits = true
+			continue
+		case t.is(tokenCommand, "nolimits"):
+			p.next()
+			base.limits = false
+			continue
+		case t.is(tokenChar, "'"):
+			p.next()
+			primes += "′"
+			continue
+		case t.is(tokenChar, "_") && sub == "":
+			p.next()
+			arg, err := p.parseArgument()
+			if err != nil {
+				return "", err
+			}
+			sub = arg
+			continue
+		case t.is(tokenChar, "^") && sup == "":
+			p.next()
+			arg, err := p.parseArgument()
+			if err != nil {
+				return "", err
+			}
+			sup = arg
+			continue
+		case t.is(tokenChar, "_"), t.is(tokenChar, "^"):
+			return "", unsupported("double %s", t.value)
+		}
+		break
+	}
+
+	if primes != "" {
+		sup = row([]string{"<mo>" + primes + "</mo>", sup})
+	}
+
+	node := base.node
+	switch {
+	case sub == "" && sup == "":
+	case base.limits && sub != "" && sup != "":
+		node = "<munderover>" + node + sub + sup + "</munderover>"
+	case base.limits && sub != "":
+		node = "<munder>" + node + sub + "</munder>"
+	case base.limits:
+		node = "<mover>" + node + sup + "</mover>"
+	case sub != "" && sup != "":
+		node = "<msubsup>" + node + sub + sup + "</msubsup>"
+	case sub != "":
+		node = "<msub>" + node + sub + "</msub>"
+	default:
+		node = "<msup>" + node + sup + "</msup>"
+	}
+
+	if base.function {
+		node = "<mrow>" + node + "<mo>⁡</mo></mrow>"
+	}
+	return node, nil
+}
+
+// parseArgument parses the argument of a command or script: a group or a
+// single token.
+func (p *parser) parseArgument() (string, error) {
+	t := p.peek()
+	switch {
+	case t.kind == tokenEOF:
+		return "", unsupported("missing argument")
+	case t.kind == tokenChar && t.value >= "0" && t.value <= "9" && len(t.value) == 1:
+		// x^10 raises only the 1.
+		p.next()
+		return p.number(t.value), nil
+	}
+
+	a, err := p.parseAtom()
+	if err != nil {
+		return "", err
+	}
+	if a.node == "" {
+		return "<mrow></mrow>", nil
+	}
+	return a.node, nil
+}
+
+// parseGroup parses the contents of a {...} group whose brace was consumed.
+func (p *parser) parseGroup() (string, error) {
+	nodes, err := p.parseList()
+	if err != nil {
+		return "", err
+	}
+	if t := p.next(); !t.is(tokenChar, "}") {
+		return "", unsupported("unbalanced braces")
+	}
+	return row(nodes), nil
+}
+
+func (p *parser) parseAtom() (atom, error) {
+	t := p.next()
+
+	if t.kind == tokenChar {
+		return p.parseChar(t.value)
+	}
+	if t.kind == tokenEOF {
+		return atom{}, unsupported("missing argument")
+	}
+
+	name := t.value
+	if s, ok := identifiers[name]; ok {
+		return atom{node: p.identifier(s)}, nil
+	}
+	if s, ok := uprightIdentifiers[name]; ok {
+		if p.variant != "" {
+			return atom{node: p.identifier(s)}, nil
+		}
+		return atom{node: `<mi mathvariant="normal">` + s + `</mi>`}, nil
+	}
+	if s, ok := operators[name]; ok {
+		return atom{node: "<mo>" + s + "</mo>"}, nil
+	}
+	if s, ok := largeOperators[name]; ok {
+		return atom{node: `<mo largeop="true" movablelimits="false">` + s + "</mo>", limits: p.display}, nil
+	}
+	if s, ok := integrals[name]; ok {
+		return atom{node: `<mo largeop="true">` + s + "</mo>"}, nil
+	}
+	if functions[name] {
+		spelled := name
+		if s, ok := functionNames[name]; ok {
+			spelled = s
+		}
+		return atom{node: "<mi>" + spelled + "</mi>", limits: limitFunctions[name] && p.display, function: true}, nil
+	}
+	if width, ok := spaces[name]; ok {
+		return atom{node: `<mspace width="` + width + `"></mspace>`}, nil
+	}
+	if s, ok := escapes[name]; ok {
+		if s == "{" || s == "}" || s == "‖" {
+			return atom{node: "<mo>" + s + "</mo>"}, nil
+		}
+		return atom{node: "<mi>" + html.EscapeString(s) + "</mi>"}, nil
+	}
+	if accent, ok := accents[name]; ok {
+		arg, err := p.parseArgument()
+		if err != nil {
+			return atom{}, err
+		}
+		return atom{node: fmt.Sprintf(`<mover accent="true">%s<mo stretchy="%t">%s</mo></mover>`, arg, accent.stretch, html.EscapeString(accent.mark))}, nil
+	}
+	if size, ok := delimiterSizes[name]; ok {
+		delim, err := p.delimiter()
+		if err != nil {
+			return atom{}, err
+		}
+		return atom{node: fmt.Sprintf(`<mo minsize="%s" maxsize="%s">%s</mo>`, size, size, delim)}, nil
+	}
+	if variant, ok := fontVariants[name]; ok {
+		if strings.HasPrefix(name, "text") {
+			return p.text(variant)
+		}
+		outer := p.variant
+		p.variant = variant
+		arg, err := p.parseArgument()
+		p.variant = outer
+		return atom{node: arg}, err
+	}
+
+	switch name {
+	case "frac", "dfrac", "tfrac", "cfrac":
+		num, err := p.parseArgument()
+		if err != nil {
+			return atom{}, err
+		}
+		den, err := p.parseArgument()
+		if err != nil {
+			return atom{}, err
+		}
+		frac := "<mfrac>" + num + den + "</mfrac>"
+		switch name {
+		case "dfrac", "cfrac":
+			frac = `<mstyle displaystyle="true">` + frac + "</mstyle>"
+		case "tfrac":
+			frac = `<mstyle displaystyle="false">` + frac + "</mstyle>"
+		}
+		return atom{node: frac}, nil
+	case "binom", "dbinom", "tbinom":
+		top, err := p.parseArgument()
+		if err != nil {
+			return atom{}, err
+		}
+		bottom, err := p.parseArgument()
+		if err != nil {
+			return atom{}, err
+		}
+		return atom{node: `<mrow><mo>(</mo><mfrac linethickness="0">` + top + bottom + `</mfrac><mo>)</mo></mrow>`}, nil
+	case "sqrt":
+		if p.peek().is(tokenChar, "[") {
+			p.next()
+			index, err := p.parseUntil("]")
+			if err != nil {
+				return atom{}, err
+			}
+			radicand, err := p.parseArgument()
+			if err != nil {
+				return atom{}, err
+			}
+			return atom{node: "<mroot>" + radicand + index + "</mroot>"}, nil
+		}
+		radicand, err := p.parseArgument()
+		if err != nil {
+			return atom{}, err
+		}
+		return atom{node: "<msqrt>" + radicand + "</msqrt>"}, nil
+	case "underline":
+		arg, err := p.parseArgument()
+		if err != nil {
+			return atom{}, err
+		}
+		return atom{node: `<munder accentunder="true">` + arg + `<mo stretchy="true">_</mo></munder>`}, nil
+	case "text", "mbox", "textnormal", "textup":
+		return p.text("")
+	case "operatorname":
+		text, err := p.rawGroup()
+		if err != nil {
+			return atom{}, err
+		}
+		return atom{node: "<mi>" + html.EscapeString(strings.TrimSpace(text)) + "</mi>", function: true}, nil
+	case "left":
+		return p.leftRight()
+	case "begin":
+		return p.environment()
+	case "not":
+		next := p.next()
+		if s, ok := negations[next.value]; ok {
+			return atom{node: "<mo>" + s + "</mo>"}, nil
+		}
+		return atom{}, unsupported(`\not%s`, next)
+	case "pmod":
+		arg, err := p.parseArgument()
+		if err != nil {
+			return atom{}, err
+		}
+		return atom{node: `<mrow><mspace width="1em"></mspace><mo>(</mo><mi>mod</mi><mspace width="0.3333em"></mspace>` + arg + `<mo>)</mo></mrow>`}, nil
+	case "bmod", "mod":
+		return atom{node: "<mo>mod</mo>"}, nil
+	case "textcolor", "color":
+		if name == "color" {
+			return atom{}, unsupported(`\color`)
+		}
+		color, err := p.rawGroup()
+		if err != nil {
+			return atom{}, err
+		}
+		color = strings.TrimSpace(color)
+		if !reColor.MatchString(color) {
+			return atom{}, unsupported(`\textcolor{%s}`, color)
+		}
+		arg, err := p.parseArgument()
+		if err != nil {
+			return atom{}, err
+		}
+		return atom{node: `<mstyle mathcolor="` + color + `">` + arg + "</mstyle>"}, nil
+	}
+
+	return atom{}, unsupported(`\%s`, name)
+}
+
+var reColor = regexp.MustCompile(`^(#[0-9a-fA-F]{3}|#[0-9a-fA-F]{6}|[a-zA-Z]+)$`)
+
+func (p *parser) parseChar(c string) (atom, error) {
+	r := []rune(c)[0]
+
+	switch {
+	case c == "{":
+		group, err := p.parseGroup()
+		return atom{node: group}, err
+	case r >= '0' && r <= '9', c == ".":
+		return atom{node: p.number(c + p.digits())}, nil
+	case isLetter(r):
+		return atom{node: p.identifier(c)}, nil
+	case c == "~":
+		return atom{node: `<mspace width="0.3333em"></mspace>`}, nil
+	case c == "-":
+		return atom{node: "<mo>−</mo>"}, nil
+	case c == "*":
+		return atom{node: "<mo>∗</mo>"}, nil
+	case c == "'":
+		return atom{node: "<mo>′</mo>"}, nil
+	case strings.Contains("+=<>()[]|/,;:!?", c):
+		return atom{node: "<mo>" + html.EscapeString(c) + "</mo>"}, nil
+	case c == "}", c == "&", c == "#", c == "%", c == "$", c == `\`:
+		return atom{}, unsupported("%s", c)
+	case unicode.IsLetter(r):
+		return atom{node: p.identifier(c)}, nil
+	case unicode.IsDigit(r):
+		return atom{node: "<mn>" + c + "</mn>"}, nil
+	}
+	return atom{node: "<mo>" + html.EscapeString(c) + "</mo>"}, nil
+}
+
+// digits reads the rest of a number: digits and a decimal point followed by
+// a digit.
+func (p *parser) digits() string {
+	start := p.pos
+	for p.pos < len(p.src) {
+		r := p.src[p.pos]
+		if r >= '0' && r <= '9' {
+			p.pos++
+			continue
+		}
+		if r == '.' && p.pos+1 < len(p.src) && p.src[p.pos+1] >= '0' && p.src[p.pos+1] <= '9' {
+			p.pos++
+			continue
+		}
+		break
+	}
+	return string(p.src[start:p.pos])
+}
+
+func (p *parser) number(digits string) string {
+	if p.variant != "" && p.variant != "normal" {
+		return "<mn>" + p.style(digits) + "</mn>"
+	}
+	return "<mn>" + digits + "</mn>"
+}
+
+// identifier renders a letter in the current font.
+func (p *parser) identifier(s string) string {
+	switch p.variant {
+	case "":
+		return "<mi>" + html.EscapeString(s) + "</mi>"
+	case "normal":
+		return `<mi mathvariant="normal">` + html.EscapeString(s) + "</mi>"
+	}
+	return "<mi>" + html.EscapeString(p.style(s)) + "</mi>"
+}
+
+func (p *parser) style(s string) string {
+	return strings.Map(func(r rune) rune { return styled(r, p.variant) }, s)
+}
+
+// text renders the argument of \text and friends as text.
+func (p *parser) text(variant string) (atom, error) {
+	text, err := p.rawGroup()
+	if err != nil {
+		return atom{}, err
+	}
+	if strings.ContainsAny(text, "$\\") {
+		return atom{}, unsupported("math or commands inside \\text")
+	}
+
+	if variant != "" && variant != "normal" {
+		text = strings.Map(func(r rune) rune { return styled(r, variant) }, text)
+	}
+	// Spaces at the edges of text are significant but collapse in HTML.
+	text = strings.ReplaceAll(html.EscapeString(text), " ", " ")
+	return atom{node: "<mtext>" + text + "</mtext>"}, nil
+}
+
+// parseUntil parses a list up to the closing character, which is consumed.
+// It is used for the optional [n] of \sqrt.
+func (p *parser) parseUntil(closing string) (string, error) {
+	var nodes []string
+	for {
+		t := p.peek()
+		if t.is(tokenChar, closing) {
+			p.next()
+			return row(nodes), nil
+		}
+		if t.kind == tokenEOF {
+			return "", unsupported("missing %s", closing)
+		}
+		node, err := p.parseScripted()
+		if err != nil {
+			return "", err
+		}
+		nodes = append(nodes, node)
+	}
+}
+
+// delimiter reads the delimiter after \left, \right or \big. An empty
+// string stands for the invisible delimiter ".".
+func (p *parser) delimiter() (string, error) {
+	t := p.next()
+	switch {
+	case t.is(tokenChar, "."):
+		return "", nil
+	case t.kind == tokenChar && strings.Contains("()[]|/<>", t.value):
+		switch t.value {
+		case "<":
+			return "⟨", nil
+		case ">":
+			return "⟩", nil
+		}
+		return t.value, nil
+	case t.kind == tokenCommand:
+		if s, ok := escapes[t.value]; ok && (s == "{" || s == "}" || s == "‖") {
+			return s, nil
+		}
+		if s, ok := operators[t.value]; ok {
+			switch t.value {
+			case "langle", "rangle", "lbrace", "rbrace", "lbrack", "rbrack",
+				"lvert", "rvert", "vert", "lVert", "rVert", "Vert",
+				"lfloor", "rfloor", "lceil", "rceil", "uparrow", "downarrow",
+				"Uparrow", "Downarrow", "backslash":
+				return s, nil
+			}
+		}
+	}
+	return "", unsupported("delimiter %s", t)
+}
+
+func fence(delim string) string {
+	if delim == "" {
+		return ""
+	}
+	return `<mo fence="true" stretchy="true">` + html.EscapeString(delim) + "</mo>"
+}
+
+// leftRight parses \left( ... \right) once \left was consumed, including any
+// \middle delimiters.
+func (p *parser) leftRight() (atom, error) {
+	open, err := p.delimiter()
+	if err != nil {
+		return atom{}, err
+	}
+
+	nodes := []string{fence(open)}
+	for {
+		body, err := p.parseList()
+		if err != nil {
+			return atom{}, err
+		}
+		nodes = append(nodes, body...)
+
+		t := p.next()
+		switch {
+		case t.is(tokenCommand, "middle"):
+			middle, err := p.delimiter()
+			if err != nil {
+				return atom{}, err
+			}
+			nodes = append(nodes, fence(middle))
+		case t.is(tokenCommand, "right"):
+			closing, err := p.delimiter()
+			if err != nil {
+				return atom{}, err
+			}
+			nodes = append(nodes, fence(closing))
+			return atom{node: "<mrow>" + strings.Join(nodes, "") + "</mrow>"}, nil
+		default:
+			return atom{}, unsupported(`\left without \right`)
+		}
+	}
+}
+
+// row wraps several nodes in an <mrow>.
+func row(nodes []string) string {
+	var kept []string
+	for _, n := range nodes {
+		if n != "" {
+			kept = append(kept, n)
+		}
+	}
+	if len(kept) == 1 {
+		return kept[0]
+	}
+	return "<mrow>" + strings.Join(kept, "") + "</mrow>"
+}
+
+// -----------------------------------------------------------------------------
+// Environments
+// -----------------------------------------------------------------------------
+
+// environments are the supported \begin{...} environments: the delimiters
+// around them and how their columns are aligned.
+var environments = map[string]struct {
+	open, close string
+	// align alternates right and left aligned columns, as in aligned.
+	align bool
+	// columns is the alignment of every column, if fixed.
+	columns string
+}{
+	"matrix":   {},
+	"pmatrix":  {open: "(", close: ")"},
+	"bmatrix":  {open: "[", close: "]"},
+	"Bmatrix":  {open: "{", close: "}"},
+	"vmatrix":  {open: "|", close: "|"},
+	"Vmatrix":  {open: "‖", close: "‖"},
+	"cases":    {open: "{", columns: "left"},
+	"aligned":  {align: true},
+	"align":    {align: true},
+	"align*":   {align: true},
+	"split":    {align: true},
+	"gathered": {columns: "center"},
+	"gather":   {columns: "center"},
+	"gather*":  {columns: "center"},
+	"array":    {},
+}
+
+// environment parses \begin{name} ... \end{name} once \begin was consumed.
+func (p *parser) environment() (atom, error) {
+	name, err := p.rawGroup()
+	if err != nil {
+		return atom{}, err
+	}
+	env, ok := environments[name]
+	if !ok {
+		return atom{}, unsupported(`\begin{%s}`, name)
+	}
+
+	var columns []string
+	if name == "array" {
+		spec, err := p.rawGroup()
+		if err != nil {
+			return atom{}, err
+		}
+		for _, c := range spec {
+			switch c {
+			case 'l':
+				columns = append(columns, "left")
+			case 'c':
+				columns = append(columns, "center")
+			case 'r':
+				columns = append(columns, "right")
+			case '|', ' ':
+			default:
+				return atom{}, unsupported("array column %q", c)
+			}
+		}
+	}
+
+	outer := p.display
+	p.display = env.align || env.columns == "center"
+	rows, err := p.rows()
+	p.display = outer
+	if err != nil {
+		return atom{}, err
+	}
+
+	end, err := p.rawGroup()
+	if err != nil {
+		return atom{}, err
+	}
+	if end != name {
+		return atom{}, unsupported(`\begin{%s} closed by \end{%s}`, name, end)
+	}
+
+	var b strings.Builder
+	b.WriteString("<mtable")
+	switch {
+	case env.align:
+		b.WriteString(` columnalign="right left" columnspacing="0em"`)
+	case env.columns != "":
+		b.WriteString(` columnalign="` + env.columns + `"`)
+	case columns != nil:
+		b.WriteString(` columnalign="` + strings.Join(columns, " ") + `"`)
+	}
+	b.WriteString(">")
+	for _, cells := range rows {
+		b.WriteString("<mtr>")
+		for _, cell := range cells {
+			b.WriteString("<mtd>" + cell + "</mtd>")
+		}
+		b.WriteString("</mtr>")
+	}
+	b.WriteString("</mtable>")
+
+	if env.open == "" {
+		return atom{node: b.String()}, nil
+	}
+	return atom{node: "<mrow>" + fence(env.open) + b.String() + fence(env.close) + "</mrow>"}, nil
+}
+
+// rows parses the rows of an environment up to its \end, which is consumed.
+// Rows are separated by \\ and cells by &.
+func (p *parser) rows() ([][]string, error) {
+	var rows [][]string
+	var cells []string
+	for {
+		if p.peek().is(tokenCommand, "hline") {
+			p.next()
+			continue
+		}
+
+		cell, err := p.parseList()
+		if err != nil {
+			return nil, err
+		}
+		cells = append(cells, row(cell))
+		empty := len(cells) == 1 && len(cell) == 0
+
+		t := p.next()
+		switch {
+		case t.is(tokenChar, "&"):
+		case t.is(tokenCommand, `\`), t.is(tokenCommand, "cr"):
+			rows = append(rows, cells)
+			cells = nil
+			if p.peek().is(tokenChar, "[") {
+				// The extra space of \\[2pt] is left out.
+				if _, err := p.parseUntil("]"); err != nil {
+					return nil, err
+				}
+			}
+		case t.is(tokenCommand, "end"):
+			// A trailing \\ leaves an empty last row.
+			if !empty {
+				rows = append(rows, cells)
+			}
+			return rows, nil
+		default:
+			return nil, unsupported("%s in an environment", t)
+		}
+	}
+}
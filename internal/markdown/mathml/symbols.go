@@ -0,0 +1,190 @@
+package mathml
+
+// identifiers are commands rendered as <mi>.
+var identifiers = map[string]string{
+	"alpha": "α", "beta": "β", "gamma": "γ", "delta": "δ", "epsilon": "ϵ",
+	"varepsilon": "ε", "zeta": "ζ", "eta": "η", "theta": "θ", "vartheta": "ϑ",
+	"iota": "ι", "kappa": "κ", "lambda": "λ", "mu": "μ", "nu": "ν", "xi": "ξ",
+	"omicron": "ο", "pi": "π", "varpi": "ϖ", "rho": "ρ", "varrho": "ϱ",
+	"sigma": "σ", "varsigma": "ς", "tau": "τ", "upsilon": "υ", "phi": "ϕ",
+	"varphi": "φ", "chi": "χ", "psi": "ψ", "omega": "ω",
+
+	"infty": "∞", "partial": "∂", "nabla": "∇", "hbar": "ℏ", "ell": "ℓ",
+	"emptyset": "∅", "varnothing": "∅", "aleph": "ℵ", "imath": "ı", "jmath": "ȷ",
+	"Re": "ℜ", "Im": "ℑ", "wp": "℘", "top": "⊤", "bot": "⊥", "angle": "∠",
+	"triangle": "△", "prime": "′",
+}
+
+// uprightIdentifiers are capital Greek letters, which are upright in TeX.
+var uprightIdentifiers = map[string]string{
+	"Gamma": "Γ", "Delta": "Δ", "Theta": "Θ", "Lambda": "Λ", "Xi": "Ξ",
+	"Pi": "Π", "Sigma": "Σ", "Upsilon": "Υ", "Phi": "Φ", "Psi": "Ψ",
+	"Omega": "Ω",
+}
+
+// operators are commands rendered as <mo>.
+var operators = map[string]string{
+	"pm": "±", "mp": "∓", "times": "×", "div": "÷", "cdot": "⋅", "ast": "∗",
+	"star": "⋆", "circ": "∘", "bullet": "∙", "oplus": "⊕", "ominus": "⊖",
+	"otimes": "⊗", "odot": "⊙", "setminus": "∖", "wedge": "∧", "land": "∧",
+	"vee": "∨", "lor": "∨", "neg": "¬", "lnot": "¬", "cup": "∪", "cap": "∩",
+	"sqcup": "⊔", "sqcap": "⊓", "uplus": "⊎", "dagger": "†", "ddagger": "‡",
+
+	"leq": "≤", "le": "≤", "geq": "≥", "ge": "≥", "neq": "≠", "ne": "≠",
+	"ll": "≪", "gg": "≫", "approx": "≈", "equiv": "≡", "sim": "∼",
+	"simeq": "≃", "cong": "≅", "propto": "∝", "doteq": "≐", "prec": "≺",
+	"succ": "≻", "preceq": "⪯", "succeq": "⪰", "in": "∈", "notin": "∉",
+	"ni": "∋", "subset": "⊂", "supset": "⊃", "subseteq": "⊆", "supseteq": "⊇",
+	"subsetneq": "⊊", "supsetneq": "⊋", "perp": "⊥", "parallel": "∥",
+	"mid": "∣", "nmid": "∤", "vdash": "⊢", "dashv": "⊣", "models": "⊨",
+
+	"to": "→", "rightarrow": "→", "leftarrow": "←", "gets": "←",
+	"leftrightarrow": "↔", "Rightarrow": "⇒", "Leftarrow": "⇐",
+	"Leftrightarrow": "⇔", "implies": "⟹", "impliedby": "⟸", "iff": "⟺",
+	"mapsto": "↦", "longrightarrow": "⟶", "longleftarrow": "⟵",
+	"Longrightarrow": "⟹", "Longleftarrow": "⟸", "longmapsto": "⟼",
+	"uparrow": "↑", "downarrow": "↓", "Uparrow": "⇑", "Downarrow": "⇓",
+	"nearrow": "↗", "searrow": "↘", "hookrightarrow": "↪", "hookleftarrow": "↩",
+
+	"forall": "∀", "exists": "∃", "nexists": "∄", "therefore": "∴",
+	"because": "∵", "ldots": "…", "dots": "…", "cdots": "⋯", "vdots": "⋮",
+	"ddots": "⋱", "colon": ":",
+
+	"langle": "⟨", "rangle": "⟩", "lbrace": "{", "rbrace": "}", "lbrack": "[",
+	"rbrack": "]", "lvert": "|", "rvert": "|", "vert": "|", "lVert": "‖",
+	"rVert": "‖", "Vert": "‖", "lfloor": "⌊", "rfloor": "⌋", "lceil": "⌈",
+	"rceil": "⌉", "backslash": "∖",
+}
+
+// largeOperators take limits above and below in display style.
+var largeOperators = map[string]string{
+	"sum": "∑", "prod": "∏", "coprod": "∐", "bigcup": "⋃", "bigcap": "⋂",
+	"bigvee": "⋁", "bigwedge": "⋀", "bigoplus": "⨁", "bigotimes": "⨂",
+	"bigodot": "⨀", "bigsqcup": "⨆", "biguplus": "⨄",
+}
+
+// integrals are large operators whose limits stay to the side.
+var integrals = map[string]string{
+	"int": "∫", "iint": "∬", "iiint": "∭", "oint": "∮",
+}
+
+// functions are upright operator names. Those in limitFunctions take limits
+// above and below in display style, like \lim_{x \to 0}.
+var functions = map[string]bool{
+	"sin": true, "cos": true, "tan": true, "cot": true, "sec": true, "csc": true,
+	"arcsin": true, "arccos": true, "arctan": true, "sinh": true, "cosh": true,
+	"tanh": true, "coth": true, "log": true, "ln": true, "lg": true, "exp": true,
+	"deg": true, "dim": true, "ker": true, "hom": true, "arg": true, "gcd": true,
+	"det": true, "Pr": true, "lim": true, "liminf": true, "limsup": true,
+	"max": true, "min": true, "sup": true, "inf": true,
+}
+
+var limitFunctions = map[string]bool{
+	"lim": true, "liminf": true, "limsup": true, "max": true, "min": true,
+	"sup": true, "inf": true, "det": true, "Pr": true, "gcd": true,
+}
+
+// functionNames spells the functions whose name is not their command.
+var functionNames = map[string]string{
+	"liminf": "lim inf", "limsup": "lim sup",
+}
+
+// spaces are the widths of spacing commands.
+var spaces = map[string]string{
+	",": "0.1667em", "thinspace": "0.1667em", ":": "0.2222em", ">": "0.2222em",
+	"medspace": "0.2222em", ";": "0.2778em", "thickspace": "0.2778em",
+	"!": "-0.1667em", "negthinspace": "-0.1667em", " ": "0.25em",
+	"quad": "1em", "qquad": "2em",
+}
+
+// escapes are single characters written with a backslash.
+var escapes = map[string]string{
+	"{": "{", "}": "}", "%": "%", "$": "$", "&": "&", "#": "#", "_": "_",
+	"|": "‖",
+}
+
+// accents are placed over their argument. Wide ones stretch.
+var accents = map[string]struct {
+	mark    string
+	stretch bool
+}{
+	"hat": {"^", false}, "widehat": {"^", true}, "check": {"ˇ", false},
+	"tilde": {"~", false}, "widetilde": {"~", true}, "bar": {"¯", false},
+	"overline": {"‾", true}, "vec": {"→", false}, "overrightarrow": {"→", true},
+	"overleftarrow": {"←", true}, "dot": {"˙", false}, "ddot": {"¨", false},
+	"acute": {"´", false}, "grave": {"`", false}, "breve": {"˘", false},
+}
+
+// delimiterSizes are the heights of \big and friends.
+var delimiterSizes = map[string]string{
+	"big": "1.2em", "bigl": "1.2em", "bigr": "1.2em", "bigm": "1.2em",
+	"Big": "1.623em", "Bigl": "1.623em", "Bigr": "1.623em", "Bigm": "1.623em",
+	"bigg": "2.047em", "biggl": "2.047em", "biggr": "2.047em", "biggm": "2.047em",
+	"Bigg": "2.470em", "Biggl": "2.470em", "Biggr": "2.470em", "Biggm": "2.470em",
+}
+
+// negations are the operators \not applies to.
+var negations = map[string]string{
+	"=": "≠", "<": "≮", ">": "≯", "in": "∉", "subset": "⊄", "supset": "⊅",
+	"subseteq": "⊈", "supseteq": "⊉", "equiv": "≢", "sim": "≁", "approx": "≉",
+	"leq": "≰", "geq": "≱", "le": "≰", "ge": "≱", "mid": "∤", "parallel": "∦",
+}
+
+// fontVariants are the font commands and the Unicode alphabets they use.
+// "normal" keeps letters upright; the others map letters and digits to the
+// Mathematical Alphanumeric Symbols block.
+var fontVariants = map[string]string{
+	"mathrm": "normal", "textrm": "normal", "mathup": "normal",
+	"mathbf": "bold", "textbf": "bold", "boldsymbol": "bold-italic", "bm": "bold-italic",
+	"mathit": "italic", "textit": "italic",
+	"mathbb": "double-struck", "mathcal": "script", "mathscr": "script",
+	"mathfrak": "fraktur", "mathsf": "sans-serif", "textsf": "sans-serif",
+	"mathtt": "monospace", "texttt": "monospace",
+}
+
+// alphabets are the first capital letter, small letter and digit of each
+// variant. Zero means the variant has no such characters.
+var alphabets = map[string][3]rune{
+	"bold":          {0x1D400, 0x1D41A, 0x1D7CE},
+	"italic":        {0x1D434, 0x1D44E, 0},
+	"bold-italic":   {0x1D468, 0x1D482, 0x1D7CE},
+	"script":        {0x1D49C, 0x1D4B6, 0},
+	"fraktur":       {0x1D504, 0x1D51E, 0},
+	"double-struck": {0x1D538, 0x1D552, 0x1D7D8},
+	"sans-serif":    {0x1D5A0, 0x1D5BA, 0x1D7E2},
+	"monospace":     {0x1D670, 0x1D68A, 0x1D7F6},
+}
+
+// alphabetExceptions are letters that were in Unicode before the
+// Mathematical Alphanumeric Symbols block and are left out of it.
+var alphabetExceptions = map[string]map[rune]rune{
+	"italic": {'h': 'ℎ'},
+	"script": {
+		'B': 'ℬ', 'E': 'ℰ', 'F': 'ℱ', 'H': 'ℋ', 'I': 'ℐ', 'L': 'ℒ', 'M': 'ℳ',
+		'R': 'ℛ', 'e': 'ℯ', 'g': 'ℊ', 'o': 'ℴ',
+	},
+	"fraktur": {'C': 'ℭ', 'H': 'ℌ', 'I': 'ℑ', 'R': 'ℜ', 'Z': 'ℨ'},
+	"double-struck": {
+		'C': 'ℂ', 'H': 'ℍ', 'N': 'ℕ', 'P': 'ℙ', 'Q': 'ℚ', 'R': 'ℝ', 'Z': 'ℤ',
+	},
+}
+
+// styled spells r in the alphabet of variant, or returns r unchanged.
+func styled(r rune, variant string) rune {
+	if mapped, ok := alphabetExceptions[variant][r]; ok {
+		return mapped
+	}
+	alphabet, ok := alphabets[variant]
+	if !ok {
+		return r
+	}
+	switch {
+	case r >= 'A' && r <= 'Z':
+		return alphabet[0] + r - 'A'
+	case r >= 'a' && r <= 'z':
+		return alphabet[1] + r - 'a'
+	case r >= '0' && r <= '9' && alphabet[2] != 0:
+		return alphabet[2] + r - '0'
+	}
+	return r
+}
@@ -0,0 +1,216 @@
+package markdown
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"html"
+	"regexp"
+	"strings"
+
+	"blaze/internal/config"
+	"blaze/internal/markdown/extensions"
+	"blaze/internal/utils"
+
+	"github.com/yuin/goldmark/parser"
+)
+
+// notebook is a Jupyter notebook, in nbformat 4.
+type notebook struct {
+	Cells    []notebookCell `json:"cells"`
+	Metadata struct {
+		Kernelspec struct {
+			Language string `json:"language"`
+		} `json:"kernelspec"`
+		LanguageInfo struct {
+			Name string `json:"name"`
+		} `json:"language_info"`
+	} `json:"metadata"`
+}
+
+type notebookCell struct {
+	CellType string           `json:"cell_type"`
+	Source   multiline        `json:"source"`
+	Outputs  []notebookOutput `json:"outputs"`
+}
+
+type notebookOutput struct {
+	OutputType string               `json:"output_type"`
+	Name       string               `json:"name"`
+	Text       multiline            `json:"text"`
+	Data       map[string]multiline `json:"data"`
+	Ename      string               `json:"ename"`
+	Evalue     string               `json:"evalue"`
+	Traceback  []string             `json:"traceback"`
+}
+
+// multiline is text that notebooks store as a string or a list of lines.
+type multiline string
+
+func (m *multiline) UnmarshalJSON(data []byte) error {
+	var lines []string
+	if err := json.Unmarshal(data, &lines); err == nil {
+		*m = multiline(strings.Join(lines, ""))
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	*m = multiline(s)
+	return nil
+}
+
+// reANSI matches the color codes of tracebacks.
+var reANSI = regexp.MustCompile("\x1b\\[[0-9;]*[A-Za-z]")
+
+// imageOutputs are the image types of outputs, in order of preference.
+var imageOutputs = []string{"image/png", "image/jpeg", "image/gif", "image/svg+xml"}
+
+// parseNotebook reads a notebook and its frontmatter, which is kept in a
+// first raw or markdown cell starting with ---, as Quarto does.
+func parseNotebook(content []byte) (*notebook, map[string]string, error) {
+	var nb notebook
+	if err := json.Unmarshal(content, &nb); err != nil {
+		return nil, nil, err
+	}
+
+	metadata := make(map[string]string)
+	if len(nb.Cells) > 0 && nb.Cells[0].CellType != "code" && strings.HasPrefix(string(nb.Cells[0].Source), "---\n") {
+		metadata, _ = ExtractFrontmatter(string(nb.Cells[0].Source))
+		nb.Cells = nb.Cells[1:]
+	}
+	return &nb, metadata, nil
+}
+
+// NotebookTransformer renders .ipynb Jupyter notebooks: markdown cells as
+// notes, code cells highlighted, and the text and images they output when
+// the notebook was saved. Notebooks are not run.
+type NotebookTransformer struct {
+	converter *Converter
+	rawHTML   string
+}
+
+func NewNotebookTransformer(cfg *config.Config, contentDir string, routes *utils.Routes) *NotebookTransformer {
+	return &NotebookTransformer{
+		converter: NewConverter(cfg, contentDir, routes),
+		rawHTML:   cfg.RawHTML,
+	}
+}
+
+func (t *NotebookTransformer) Name() string {
+	return "notebook"
+}
+
+func (t *NotebookTransformer) Transform(content []byte) (string, map[string]string, error) {
+	nb, metadata, err := parseNotebook(content)
+	if err != nil {
+		return "", nil, err
+	}
+
+	language := nb.Metadata.LanguageInfo.Name
+	if language == "" {
+		language = nb.Metadata.Kernelspec.Language
+	}
+	if language == "" {
+		language = "python"
+	}
+
+	ctx := parser.NewContext(parser.WithIDs(extensions.NewHeadingIDs(t.converter.slugger)))
+	var b strings.Builder
+	for _, cell := range nb.Cells {
+		switch cell.CellType {
+		case "markdown":
+			cellHTML, err := t.converter.convertPart([]byte(cell.Source), ctx)
+			if err != nil {
+				return "", nil, err
+			}
+			b.WriteString(`<div class="notebook-cell notebook-markdown">` + cellHTML + "</div>\n")
+		case "code":
+			if err := t.writeCode(&b, cell, language, ctx, metadata); err != nil {
+				return "", nil, err
+			}
+		}
+	}
+
+	setScriptFlags(ctx, metadata)
+	return b.String(), metadata, nil
+}
+
+func (t *NotebookTransformer) writeCode(b *strings.Builder, cell notebookCell, language string, ctx parser.Context, metadata map[string]string) error {
+	source := strings.TrimRight(string(cell.Source), "\n")
+	if source == "" && len(cell.Outputs) == 0 {
+		return nil
+	}
+
+	// A fence longer than any run of backticks in the code.
+	fence := "```"
+	for strings.Contains(source, fence) {
+		fence += "`"
+	}
+	code, err := t.converter.convertPart([]byte(fence+language+"\n"+source+"\n"+fence+"\n"), ctx)
+	if err != nil {
+		return err
+	}
+
+	b.WriteString(`<div class="notebook-cell notebook-code">` + code)
+	if len(cell.Outputs) > 0 {
+		b.WriteString(`<div class="notebook-outputs">`)
+		for _, out := range cell.Outputs {
+			t.writeOutput(b, out, ctx, metadata)
+		}
+		b.WriteString("</div>")
+	}
+	b.WriteString("</div>\n")
+	return nil
+}
+
+// writeOutput writes what a cell printed or displayed. Of outputs in several
+// types, images are preferred, then HTML, Markdown and plain text.
+func (t *NotebookTransformer) writeOutput(b *strings.Builder, out notebookOutput, ctx parser.Context, metadata map[string]string) {
+	switch out.OutputType {
+	case "stream":
+		class := "notebook-stream"
+		if out.Name == "stderr" {
+			class += " notebook-stderr"
+		}
+		b.WriteString(`<pre class="` + class + `">` + html.EscapeString(string(out.Text)) + "</pre>")
+		return
+	case "error":
+		traceback := reANSI.ReplaceAllString(strings.Join(out.Traceback, "\n"), "")
+		if traceback == "" {
+			traceback = out.Ename + ": " + out.Evalue
+		}
+		b.WriteString(`<pre class="notebook-error">` + html.EscapeString(traceback) + "</pre>")
+		return
+	}
+
+	for _, mime := range imageOutputs {
+		if data, ok := out.Data[mime]; ok {
+			encoded := strings.Join(strings.Fields(string(data)), "")
+			if mime == "image/svg+xml" {
+				// SVG is stored as text; as an image its scripts never run.
+				encoded = base64.StdEncoding.EncodeToString([]byte(data))
+			}
+			b.WriteString(`<img class="notebook-image" src="data:` + mime + ";base64," + html.EscapeString(encoded) + `" alt="" loading="lazy">`)
+			return
+		}
+	}
+
+	if data, ok := out.Data["text/html"]; ok {
+		filtered, modified := extensions.FilterHTML(t.rawHTML, []byte(data))
+		if modified {
+			metadata["_rawHTMLModified"] = "true"
+		}
+		b.WriteString(`<div class="notebook-html">` + string(filtered) + "</div>")
+		return
+	}
+	if data, ok := out.Data["text/markdown"]; ok {
+		if outHTML, err := t.converter.convertPart([]byte(data), ctx); err == nil {
+			b.WriteString(`<div class="notebook-html">` + outHTML + "</div>")
+			return
+		}
+	}
+	if data, ok := out.Data["text/plain"]; ok {
+		b.WriteString(`<pre class="notebook-result">` + html.EscapeString(string(data)) + "</pre>")
+	}
+}
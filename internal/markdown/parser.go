@@ -1,10 +1,14 @@
 package markdown
 
 import (
+	"blaze/internal/config"
 	"blaze/internal/markdown/extensions"
+	"blaze/internal/utils"
 	"fmt"
+	"path/filepath"
 	"strings"
 
+	"github.com/yuin/goldmark"
 	meta "github.com/yuin/goldmark-meta"
 	"github.com/yuin/goldmark/parser"
 	"github.com/yuin/goldmark/text"
@@ -17,11 +21,10 @@ type Page struct {
 	Metadata    map[string]string
 }
 
-func Parse(content []byte) (*Page, error) {
-	converter := NewConverter()
-	ctx := parser.NewContext()
+func (c *Converter) Parse(content []byte) (*Page, error) {
+	ctx := parser.NewContext(parser.WithIDs(extensions.NewHeadingIDs(c.slugger)))
 
-	htmlContent, err := converter.ConvertWithContext(content, ctx)
+	htmlContent, err := c.ConvertWithContext(content, ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -29,12 +32,18 @@ func Parse(content []byte) (*Page, error) {
 	metaData := meta.Get(ctx)
 	metadata := convertMetadata(metaData)
 
-	if ctx.Get(extensions.MermaidContextKey) != nil {
-		metadata["hasMermaid"] = "true"
+	setScriptFlags(ctx, metadata)
+
+	if fallback, ok := ctx.Get(extensions.MathFallbackKey).(string); ok {
+		metadata["_mathFallback"] = fallback
+	}
+
+	if errs, ok := ctx.Get(extensions.IncludeErrorsKey).(string); ok {
+		metadata["_includeErrors"] = errs
 	}
 
-	if ctx.Get(extensions.KatexContextKey) != nil {
-		metadata["hasKatex"] = "true"
+	if ctx.Get(extensions.RawHTMLModifiedKey) != nil {
+		metadata["_rawHTMLModified"] = "true"
 	}
 
 	title := metadata["title"]
@@ -42,7 +51,7 @@ func Parse(content []byte) (*Page, error) {
 		title = "Untitled"
 	}
 
-	bodyContent := extractBody(string(content))
+	bodyContent := extractBody(string(extensions.WithoutComments(content, ctx)))
 
 	return &Page{
 		Title:       title,
@@ -52,9 +61,33 @@ func Parse(content []byte) (*Page, error) {
 	}, nil
 }
 
+// scriptFlags are the metadata flags of the pages that need a script, set
+// when an extension sets the context key.
+var scriptFlags = []struct {
+	key  parser.ContextKey
+	flag string
+}{
+	{extensions.MermaidContextKey, "hasMermaid"},
+	{extensions.KatexContextKey, "hasKatex"},
+	{extensions.EmbedContextKey, "hasEmbed"},
+	{extensions.LightboxContextKey, "hasLightbox"},
+}
+
+func setScriptFlags(ctx parser.Context, metadata map[string]string) {
+	for _, f := range scriptFlags {
+		if ctx.Get(f.key) != nil {
+			metadata[f.flag] = "true"
+		}
+	}
+}
+
+// frontmatterParser only understands frontmatter, so extracting metadata
+// does not pay for the full extension set.
+var frontmatterParser = goldmark.New(goldmark.WithExtensions(meta.Meta))
+
 func ExtractFrontmatter(textStr string) (map[string]string, string) {
 	content := []byte(textStr)
-	md := newGoldmark()
+	md := frontmatterParser
 
 	ctx := parser.NewContext()
 	p := md.Parser()
@@ -69,6 +102,20 @@ func ExtractFrontmatter(textStr string) (map[string]string, string) {
 	return metadata, body
 }
 
+// PageFrontmatter returns the frontmatter of the page in the file name,
+// wherever its format keeps it.
+func PageFrontmatter(name string, content []byte) map[string]string {
+	if strings.EqualFold(filepath.Ext(name), ".ipynb") {
+		_, metadata, err := parseNotebook(content)
+		if err != nil {
+			return make(map[string]string)
+		}
+		return metadata
+	}
+	metadata, _ := ExtractFrontmatter(string(content))
+	return metadata
+}
+
 func extractBody(text string) string {
 	if !strings.HasPrefix(text, "---\n") {
 		return text
@@ -90,10 +137,12 @@ func convertMetadata(metaData map[string]interface{}) map[string]string {
 	return metadata
 }
 
-type MarkdownTransformer struct{}
+type MarkdownTransformer struct {
+	converter *Converter
+}
 
-func NewTransformer() *MarkdownTransformer {
-	return &MarkdownTransformer{}
+func NewTransformer(cfg *config.Config, contentDir string, routes *utils.Routes) *MarkdownTransformer {
+	return &MarkdownTransformer{converter: NewConverter(cfg, contentDir, routes)}
 }
 
 func (t *MarkdownTransformer) Name() string {
@@ -101,7 +150,7 @@ func (t *MarkdownTransformer) Name() string {
 }
 
 func (t *MarkdownTransformer) Transform(content []byte) (string, map[string]string, error) {
-	page, err := Parse(content)
+	page, err := t.converter.Parse(content)
 	if err != nil {
 		return "", nil, err
 	}
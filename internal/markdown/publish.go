@@ -0,0 +1,83 @@
+package markdown
+
+import (
+	"path/filepath"
+	"strings"
+	"time"
+
+	"blaze/internal/config"
+)
+
+// dateLayouts are the formats accepted for the date and expires frontmatter.
+// Dates without a time zone are in local time.
+var dateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05 -0700 MST",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// IsIgnored reports whether the content file at relPath is left out of the
+// site altogether: folder defaults, and the files the ignorePatterns of the
+// config match by their name or the name of a folder they are in. Nothing
+// reads the content of an ignored file into a page, not even an embed.
+func IsIgnored(cfg *config.Config, relPath string) bool {
+	if filepath.Base(relPath) == FolderDefaultsFile {
+		return true
+	}
+
+	for _, pattern := range cfg.IgnorePatterns {
+		for _, part := range strings.Split(filepath.ToSlash(relPath), "/") {
+			if part == pattern {
+				return true
+			}
+			if matched, err := filepath.Match(pattern, part); err == nil && matched {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ReasonNotPublished is the skip reason of pages left out by explicit
+// publishing.
+const ReasonNotPublished = "not marked publish: true"
+
+// SkipReason returns why the page with the given metadata is left out of the
+// site, or "" if it is published. The pipeline leaves skipped pages out of
+// the routes, so the explorer and links never point to them.
+func SkipReason(cfg *config.Config, metadata map[string]string) string {
+	if cfg.PublishMode == "explicit" && metadata["publish"] != "true" {
+		return ReasonNotPublished
+	}
+
+	if !cfg.Drafts && metadata["draft"] == "true" {
+		return "draft"
+	}
+
+	if date, ok := parseDate(metadata["date"]); ok && !cfg.Future && date.After(cfg.BuildTime) {
+		return "scheduled for " + metadata["date"]
+	}
+
+	if expires, ok := parseDate(metadata["expires"]); ok && !expires.After(cfg.BuildTime) {
+		return "expired on " + metadata["expires"]
+	}
+
+	return ""
+}
+
+func parseDate(value string) (time.Time, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}, false
+	}
+
+	for _, layout := range dateLayouts {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
@@ -1,19 +1,31 @@
 package pipeline
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 
+	"blaze/internal/assets"
 	"blaze/internal/config"
+	"blaze/internal/images"
+	"blaze/internal/markdown"
+	"blaze/internal/markdown/extensions"
 	"blaze/internal/renderer"
 	"blaze/internal/utils"
 
 	"golang.org/x/sync/errgroup"
 )
 
+// imageCacheDir keeps the resized variants of images between builds.
+const imageCacheDir = ".blaze-cache/images"
+
 type Transformer interface {
 	Name() string
 	Transform(content []byte) (string, map[string]string, error)
@@ -22,26 +34,90 @@ type Transformer interface {
 type Pipeline struct {
 	config       *config.Config
 	renderer     *renderer.HTMLRenderer
+	routes       *utils.Routes
+	folders      *markdown.FolderDefaults
 	transformers map[string]Transformer
+	images       *images.Processor
+
+	mu              sync.Mutex
+	skipped         []skippedPage
+	rawHTMLModified []string
+	mathFallback    []string
+	includeErrors   []string
+
+	// digests fingerprint each page written, by output path, so the dev
+	// server can tell which pages a rebuild changed.
+	digests map[string]string
+
+	// Libraries the generated pages load.
+	usesKatex   atomic.Bool
+	usesMermaid atomic.Bool
+}
+
+// skippedPage is a page left out of the site, reported after the build.
+type skippedPage struct {
+	relPath string
+	reason  string
 }
 
-func NewPipeline(cfg *config.Config, renderer *renderer.HTMLRenderer) *Pipeline {
+func NewPipeline(cfg *config.Config, renderer *renderer.HTMLRenderer, routes *utils.Routes) *Pipeline {
 	return &Pipeline{
 		config:       cfg,
 		renderer:     renderer,
+		routes:       routes,
 		transformers: make(map[string]Transformer),
+		images:       newImageProcessor(cfg),
 	}
 }
 
+func newImageProcessor(cfg *config.Config) *images.Processor {
+	opts := markdown.ImageOptions(cfg)
+	opts.CacheDir = imageCacheDir
+	return images.NewProcessor(opts)
+}
+
+// RegisterTransformer renders the files whose name ends in ext as pages.
+// The longest matching ext wins, so ".excalidraw.md" can be handled apart
+// from ".md".
 func (p *Pipeline) RegisterTransformer(ext string, transformer Transformer) {
 	p.transformers[ext] = transformer
 }
 
+// transformerFor returns the transformer of the file at path and the
+// extension it was registered for.
+func (p *Pipeline) transformerFor(path string) (Transformer, string, bool) {
+	name := strings.ToLower(filepath.Base(path))
+	var match string
+	for ext := range p.transformers {
+		if strings.HasSuffix(name, ext) && len(ext) > len(match) {
+			match = ext
+		}
+	}
+	if match == "" {
+		return nil, "", false
+	}
+	return p.transformers[match], match, true
+}
+
 func (p *Pipeline) Process(contentDir, outputDir string) error {
+	p.folders = markdown.NewFolderDefaults(contentDir)
+	p.skipped = nil
+	p.rawHTMLModified = nil
+	p.mathFallback = nil
+	p.includeErrors = nil
+	p.usesKatex.Store(false)
+	p.usesMermaid.Store(false)
+
+	if err := p.resolveRoutes(contentDir); err != nil {
+		return err
+	}
+
 	if err := p.renderer.RegenerateExplorer(contentDir); err != nil {
 		return fmt.Errorf("failed to generate explorer: %w", err)
 	}
 
+	p.digests = make(map[string]string)
+
 	var g errgroup.Group
 
 	sem := make(chan struct{}, 20)
@@ -55,8 +131,9 @@ func (p *Pipeline) Process(contentDir, outputDir string) error {
 			return nil
 		}
 
+		// Ignored files and skipped pages have no route.
 		relPath, _ := filepath.Rel(contentDir, path)
-		if p.shouldIgnore(relPath) {
+		if _, ok := p.routes.Get(relPath); !ok {
 			return nil
 		}
 
@@ -74,7 +151,98 @@ func (p *Pipeline) Process(contentDir, outputDir string) error {
 		return err
 	}
 
-	return g.Wait()
+	if err := g.Wait(); err != nil {
+		return err
+	}
+
+	p.reportSkipped()
+	p.reportRawHTML()
+	p.reportMathFallback()
+	p.reportIncludeErrors()
+	return nil
+}
+
+// Digests returns the digest of every page written by the last Process, keyed
+// by output path relative to the output directory.
+func (p *Pipeline) Digests() map[string]string {
+	return p.digests
+}
+
+// resolveRoutes assigns every content file its output path before anything
+// is written, so files whose names slugify to the same path are detected
+// instead of overwriting each other. Skipped pages get no route, so nothing
+// links to them.
+func (p *Pipeline) resolveRoutes(contentDir string) error {
+	err := filepath.Walk(contentDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			return nil
+		}
+
+		relPath, _ := filepath.Rel(contentDir, path)
+		if markdown.IsIgnored(p.config, relPath) {
+			return nil
+		}
+
+		_, _, isPage := p.transformerFor(path)
+		if isPage {
+			reason, err := p.skipReason(path, relPath)
+			if err != nil {
+				return err
+			}
+			if reason != "" {
+				p.skipped = append(p.skipped, skippedPage{relPath: relPath, reason: reason})
+				return nil
+			}
+		}
+
+		p.routes.Add(relPath, isPage)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	collisions := p.routes.Resolve()
+	if len(collisions) == 0 {
+		return nil
+	}
+
+	var report strings.Builder
+	for _, c := range collisions {
+		fmt.Fprintf(&report, "\n  %s is claimed by %s", c.Path, strings.Join(c.Sources, ", "))
+		for _, source := range c.Sources[1:] {
+			if route, ok := p.routes.Get(source); ok {
+				fmt.Fprintf(&report, "\n    %s -> %s", source, route.Output)
+			}
+		}
+	}
+
+	if p.config.SlugCollisions == "error" {
+		return fmt.Errorf("slug collisions:%s", report.String())
+	}
+
+	fmt.Printf("Warning: slug collisions, renamed:%s\n", report.String())
+	return nil
+}
+
+// skipReason returns why the page at path is left out of the site, or "" if
+// it is published. Only the frontmatter is read, so every route is known
+// before the first page is rendered.
+func (p *Pipeline) skipReason(path, relPath string) (string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	metadata := markdown.PageFrontmatter(path, content)
+	if err := p.folders.Apply(relPath, metadata); err != nil {
+		return "", err
+	}
+	return markdown.SkipReason(p.config, metadata), nil
 }
 
 func (p *Pipeline) ProcessTemplates(templateDir, outputDir string) error {
@@ -92,16 +260,91 @@ func (p *Pipeline) ProcessTemplates(templateDir, outputDir string) error {
 		}
 
 		relPath, _ := filepath.Rel(templateDir, path)
-		return p.copyStatic(path, relPath, outputDir)
+		return p.copyStatic(path, filepath.Join(outputDir, utils.StaticOutputPath(relPath)))
 	})
 }
 
+// CopyAssets copies the embedded libraries used by the pages of the last
+// Process into the output directory, in local asset mode.
+func (p *Pipeline) CopyAssets(outputDir string) error {
+	if p.config.AssetMode != assets.ModeLocal {
+		return nil
+	}
+
+	libraries := []struct {
+		library assets.Library
+		used    bool
+	}{
+		{assets.Katex, p.usesKatex.Load()},
+		{assets.Mermaid, p.usesMermaid.Load()},
+	}
+
+	for _, l := range libraries {
+		if !l.used {
+			continue
+		}
+		if err := l.library.Copy(outputDir); err != nil {
+			return err
+		}
+		fmt.Printf("Copied: %s\n", filepath.Join(outputDir, assets.OutputDir, l.library.Name))
+	}
+	return nil
+}
+
+// GenerateSyntaxCSS writes the stylesheet for highlighted code, generated
+// from the syntaxLight and syntaxDark styles. Templates are copied after it,
+// so a blaze-styles/syntax.css among them replaces it.
+func (p *Pipeline) GenerateSyntaxCSS(outputDir string) error {
+	css, err := markdown.SyntaxCSS(p.config)
+	if err != nil {
+		return fmt.Errorf("failed to generate syntax.css: %w", err)
+	}
+
+	outputPath := filepath.Join(outputDir, "blaze-styles", "syntax.css")
+	if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(outputPath, css, 0644); err != nil {
+		return err
+	}
+
+	fmt.Printf("Generated: %s\n", outputPath)
+	return nil
+}
+
+// GenerateNotFound writes the 404 page served by hosts for missing URLs.
+func (p *Pipeline) GenerateNotFound(outputDir string) error {
+	notFoundHTML, err := p.renderer.RenderNotFound()
+	if err != nil {
+		return fmt.Errorf("failed to render 404 page: %w", err)
+	}
+	if notFoundHTML == "" {
+		return nil
+	}
+
+	outputPath := filepath.Join(outputDir, "404.html")
+	if err := p.writePage(outputDir, outputPath, notFoundHTML, notFoundHTML); err != nil {
+		return err
+	}
+
+	fmt.Printf("Generated: %s\n", outputPath)
+	return nil
+}
+
 func (p *Pipeline) processFile(sourcePath, relPath, outputDir string) error {
-	ext := filepath.Ext(sourcePath)
-	transformer, ok := p.transformers[ext]
+	route, ok := p.routes.Get(relPath)
+	if !ok {
+		return fmt.Errorf("no route for %s", relPath)
+	}
+	outputPath := filepath.Join(outputDir, route.Output)
+
+	transformer, ext, ok := p.transformerFor(sourcePath)
 
 	if !ok {
-		return p.copyStatic(sourcePath, relPath, outputDir)
+		if err := p.copyStatic(sourcePath, outputPath); err != nil {
+			return err
+		}
+		return p.resizeImage(sourcePath, outputPath)
 	}
 
 	content, err := os.ReadFile(sourcePath)
@@ -114,15 +357,54 @@ func (p *Pipeline) processFile(sourcePath, relPath, outputDir string) error {
 		return fmt.Errorf("failed to transform %s: %w", sourcePath, err)
 	}
 
-	if p.config.PublishMode == "explicit" {
-		if val, ok := metadata["publish"]; !ok || val != "true" {
-			return nil
+	if err := p.folders.Apply(relPath, metadata); err != nil {
+		return err
+	}
+
+	if metadata["hasKatex"] == "true" {
+		p.usesKatex.Store(true)
+	}
+	if metadata["hasMermaid"] == "true" {
+		p.usesMermaid.Store(true)
+	}
+
+	if metadata["_rawHTMLModified"] == "true" {
+		delete(metadata, "_rawHTMLModified")
+		p.mu.Lock()
+		p.rawHTMLModified = append(p.rawHTMLModified, relPath)
+		p.mu.Unlock()
+	}
+
+	if fallback, ok := metadata["_mathFallback"]; ok {
+		delete(metadata, "_mathFallback")
+		p.mu.Lock()
+		p.mathFallback = append(p.mathFallback, relPath+": "+fallback)
+		p.mu.Unlock()
+	}
+
+	if errs, ok := metadata["_includeErrors"]; ok {
+		delete(metadata, "_includeErrors")
+		p.mu.Lock()
+		p.includeErrors = append(p.includeErrors, relPath+": "+errs)
+		p.mu.Unlock()
+	}
+
+	password, protected, err := pagePassword(metadata)
+	if err != nil {
+		return fmt.Errorf("failed to protect %s: %w", sourcePath, err)
+	}
+	plainContent := htmlContent
+	if protected {
+		htmlContent, err = protect(htmlContent, password)
+		if err != nil {
+			return fmt.Errorf("failed to protect %s: %w", sourcePath, err)
 		}
+		metadata["hasPassword"] = "true"
 	}
 
 	// Add filename without extension to metadata
 	filename := filepath.Base(sourcePath)
-	filenameWithoutExt := strings.TrimSuffix(filename, filepath.Ext(filename))
+	filenameWithoutExt := filename[:len(filename)-len(ext)]
 	metadata["_filename"] = filenameWithoutExt
 
 	finalHTML, err := p.renderer.RenderPage(htmlContent, metadata)
@@ -130,36 +412,122 @@ func (p *Pipeline) processFile(sourcePath, relPath, outputDir string) error {
 		return err
 	}
 
-	dir := filepath.Dir(relPath)
-	sluggedDir := utils.SlugifyPath(dir)
-	slug := utils.PathToSlug(relPath)
-	outputPath := filepath.Join(outputDir, sluggedDir, slug+".html")
+	// The ciphertext of a protected page differs on every build, so its
+	// digest is taken over the page with the content before encryption.
+	fingerprint := strings.Replace(finalHTML, htmlContent, plainContent, 1)
+	if err := p.writePage(outputDir, outputPath, finalHTML, fingerprint); err != nil {
+		return err
+	}
+
+	fmt.Printf("Generated: %s\n", outputPath)
+	return nil
+}
 
+// writePage writes a page and records the digest of fingerprint, the content
+// that changes when the page does. Every page goes through it, whatever built
+// it, so the dev server sees every page a rebuild changes.
+func (p *Pipeline) writePage(outputDir, outputPath, html, fingerprint string) error {
 	if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
 		return err
 	}
 
-	if err := os.WriteFile(outputPath, []byte(finalHTML), 0644); err != nil {
+	if err := os.WriteFile(outputPath, []byte(html), 0644); err != nil {
 		return err
 	}
 
-	fmt.Printf("Generated: %s\n", outputPath)
+	output, err := filepath.Rel(outputDir, outputPath)
+	if err != nil {
+		return err
+	}
+	digest := sha256.Sum256([]byte(fingerprint))
+
+	p.mu.Lock()
+	p.digests[output] = hex.EncodeToString(digest[:])
+	p.mu.Unlock()
 	return nil
 }
 
-func (p *Pipeline) copyStatic(sourcePath, relPath, outputDir string) error {
-	dir := filepath.Dir(relPath)
-	base := filepath.Base(relPath)
-	ext := filepath.Ext(base)
-	nameWithoutExt := strings.TrimSuffix(base, ext)
+// reportSkipped lists the pages left out of the site and why. Pages that are
+// simply not marked for publishing are only counted, since under explicit
+// publishing they are usually most of the vault.
+func (p *Pipeline) reportSkipped() {
+	sort.Slice(p.skipped, func(i, j int) bool {
+		return p.skipped[i].relPath < p.skipped[j].relPath
+	})
+
+	unpublished := 0
+	var report strings.Builder
+	for _, page := range p.skipped {
+		if page.reason == markdown.ReasonNotPublished {
+			unpublished++
+			continue
+		}
+		fmt.Fprintf(&report, "\n  %s: %s", page.relPath, page.reason)
+	}
+
+	if report.Len() > 0 {
+		fmt.Printf("Skipped:%s\n", report.String())
+	}
+	if unpublished > 0 {
+		fmt.Printf("Skipped %d pages not marked publish: true\n", unpublished)
+	}
+}
+
+// reportRawHTML lists the pages whose raw HTML was changed by the rawHTML
+// setting, so authors can see what did not make it to the site.
+func (p *Pipeline) reportRawHTML() {
+	if len(p.rawHTMLModified) == 0 {
+		return
+	}
+	sort.Strings(p.rawHTMLModified)
+
+	action := "sanitized"
+	if p.config.RawHTML == extensions.RawHTMLStrip {
+		action = "stripped"
+	}
+	fmt.Printf("Warning: raw HTML %s in:\n  %s\n", action, strings.Join(p.rawHTMLModified, "\n  "))
+}
+
+// reportMathFallback lists the pages with formulas the mathml math rendering
+// could not convert, and the constructs responsible. Those formulas are
+// rendered by KaTeX in the browser instead.
+func (p *Pipeline) reportMathFallback() {
+	if len(p.mathFallback) == 0 {
+		return
+	}
+	sort.Strings(p.mathFallback)
+	fmt.Printf("Warning: math left to KaTeX in the browser in:\n  %s\n", strings.Join(p.mathFallback, "\n  "))
+}
 
-	slug := utils.PathToSlug(nameWithoutExt)
-	normalizedExt := strings.ToLower(ext)
-	normalizedBase := slug + normalizedExt
+// reportIncludeErrors lists the source file embeds that could not be
+// resolved. They are left as links or code blocks.
+func (p *Pipeline) reportIncludeErrors() {
+	if len(p.includeErrors) == 0 {
+		return
+	}
+	sort.Strings(p.includeErrors)
+	fmt.Printf("Warning: files not embedded in:\n  %s\n", strings.Join(p.includeErrors, "\n  "))
+}
 
-	sluggedDir := utils.SlugifyPath(dir)
-	outputPath := filepath.Join(outputDir, sluggedDir, normalizedBase)
+// resizeImage writes the resized variants of an image, which pages list in
+// the srcset of the image. An image that cannot be read is still published,
+// at full size only.
+func (p *Pipeline) resizeImage(sourcePath, outputPath string) error {
+	if !images.IsResizable(sourcePath) {
+		return nil
+	}
+	variants, err := p.images.Generate(sourcePath, outputPath)
+	if err != nil {
+		fmt.Printf("Warning: image not resized: %s: %v\n", sourcePath, err)
+		return nil
+	}
+	for _, variant := range variants {
+		fmt.Printf("Resized: %s\n", variant)
+	}
+	return nil
+}
 
+func (p *Pipeline) copyStatic(sourcePath, outputPath string) error {
 	if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
 		return err
 	}
@@ -182,26 +550,3 @@ func (p *Pipeline) copyStatic(sourcePath, relPath, outputDir string) error {
 	}
 	return err
 }
-
-func (p *Pipeline) shouldIgnore(relPath string) bool {
-	pathParts := strings.Split(filepath.ToSlash(relPath), "/")
-	baseName := filepath.Base(relPath)
-
-	for _, pattern := range p.config.IgnorePatterns {
-		for _, part := range pathParts {
-			matched, err := filepath.Match(pattern, part)
-			if err == nil && matched {
-				return true
-			}
-			if part == pattern {
-				return true
-			}
-		}
-
-		matched, err := filepath.Match(pattern, baseName)
-		if err == nil && matched {
-			return true
-		}
-	}
-	return false
-}
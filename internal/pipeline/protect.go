@@ -0,0 +1,84 @@
+package pipeline
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"os"
+)
+
+// pbkdf2Iterations is the PBKDF2-SHA256 work factor for page keys. The
+// browser derives the same key with WebCrypto when the password is entered.
+const pbkdf2Iterations = 600000
+
+// pagePassword returns the password a page is protected with: the password
+// frontmatter, or the environment variable named by passwordEnv so the
+// password can stay out of the vault. Both keys are removed from metadata so
+// they never reach the template.
+func pagePassword(metadata map[string]string) (string, bool, error) {
+	password, hasPassword := metadata["password"]
+	envName, hasEnv := metadata["passwordEnv"]
+	delete(metadata, "password")
+	delete(metadata, "passwordEnv")
+
+	switch {
+	case hasEnv:
+		password, ok := os.LookupEnv(envName)
+		if !ok || password == "" {
+			return "", false, fmt.Errorf("passwordEnv %s is not set", envName)
+		}
+		return password, true, nil
+	case hasPassword:
+		if password == "" {
+			return "", false, fmt.Errorf("password is empty")
+		}
+		return password, true, nil
+	}
+	return "", false, nil
+}
+
+// protect encrypts the rendered article with AES-256-GCM under a key derived
+// from password, and returns the form blaze-scripts/protect.js decrypts it
+// with. The salt and nonce are random for every build.
+func protect(htmlContent, password string) (string, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key, err := pbkdf2.Key(sha256.New, password, salt, pbkdf2Iterations, 32)
+	if err != nil {
+		return "", err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	ciphertext := gcm.Seal(nil, nonce, []byte(htmlContent), nil)
+
+	encode := base64.StdEncoding.EncodeToString
+	return fmt.Sprintf(
+		`<div class="protected" data-salt="%s" data-iv="%s" data-iterations="%d" data-ciphertext="%s">`+
+			`<form class="protected-form">`+
+			`<p>This page is password protected.</p>`+
+			`<input type="password" name="password" placeholder="Password" autocomplete="current-password" required />`+
+			`<button type="submit">Unlock</button>`+
+			`<p class="protected-error" hidden>Wrong password.</p>`+
+			`</form></div>`,
+		encode(salt), encode(nonce), pbkdf2Iterations, encode(ciphertext),
+	), nil
+}
@@ -3,31 +3,46 @@ package renderer
 import (
 	"bytes"
 	"html/template"
+	"os"
 	"path/filepath"
 
+	"blaze/internal/assets"
 	"blaze/internal/components"
 	"blaze/internal/config"
 	"blaze/internal/markdown"
+	"blaze/internal/utils"
 )
 
 type HTMLRenderer struct {
 	template         *template.Template
+	notFound         *template.Template
 	config           *config.Config
 	componentFactory *components.ComponentFactory
 	explorerCache    template.HTML
 }
 
-func NewHTMLRenderer(templateDir string, cfg *config.Config) (*HTMLRenderer, error) {
+func NewHTMLRenderer(templateDir string, cfg *config.Config, routes *utils.Routes) (*HTMLRenderer, error) {
 	tmplPath := filepath.Join(templateDir, "layout.html")
 	tmpl, err := template.ParseFiles(tmplPath)
 	if err != nil {
 		return nil, err
 	}
 
+	// The 404 layout is optional; sites without one get no 404 page.
+	var notFound *template.Template
+	notFoundPath := filepath.Join(templateDir, "404.html")
+	if _, err := os.Stat(notFoundPath); err == nil {
+		notFound, err = template.ParseFiles(notFoundPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return &HTMLRenderer{
 		template:         tmpl,
+		notFound:         notFound,
 		config:           cfg,
-		componentFactory: components.NewComponentFactory(cfg),
+		componentFactory: components.NewComponentFactory(cfg, routes),
 	}, nil
 }
 
@@ -61,6 +76,8 @@ func (r *HTMLRenderer) Render(page *markdown.Page) (string, error) {
 		"GraphView":       "",
 		"TableOfContent":  "",
 		"Backlinks":       "",
+		"KatexURL":        assets.Katex.URL(r.config.AssetMode),
+		"MermaidURL":      assets.Mermaid.URL(r.config.AssetMode),
 	}
 
 	for k, v := range page.Metadata {
@@ -99,6 +116,8 @@ func (r *HTMLRenderer) RenderPage(htmlContent string, metadata map[string]string
 		"GraphView":       "",
 		"TableOfContent":  "",
 		"Backlinks":       "",
+		"KatexURL":        assets.Katex.URL(r.config.AssetMode),
+		"MermaidURL":      assets.Mermaid.URL(r.config.AssetMode),
 	}
 
 	for k, v := range metadata {
@@ -112,3 +131,26 @@ func (r *HTMLRenderer) RenderPage(htmlContent string, metadata map[string]string
 
 	return buf.String(), nil
 }
+
+// RenderNotFound renders the 404 layout inside the page layout. It returns an
+// empty string when the template directory has no 404 layout.
+func (r *HTMLRenderer) RenderNotFound() (string, error) {
+	if r.notFound == nil {
+		return "", nil
+	}
+
+	data := map[string]any{
+		"SiteName": r.config.PageTitle,
+		"Locale":   r.config.Locale,
+	}
+
+	var buf bytes.Buffer
+	if err := r.notFound.Execute(&buf, data); err != nil {
+		return "", err
+	}
+
+	return r.RenderPage(buf.String(), map[string]string{
+		"title":      "Page not found",
+		"isNotFound": "true",
+	})
+}
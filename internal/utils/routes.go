@@ -0,0 +1,193 @@
+package utils
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Route is where a content file ends up in the generated site.
+type Route struct {
+	Source string
+	Output string
+	URL    string
+	Page   bool
+}
+
+// Collision lists the content files that would be written to the same output
+// path or served at the same URL. Sources are sorted: the first one keeps
+// Path and the others are renamed.
+type Collision struct {
+	Path    string
+	Sources []string
+}
+
+// Routes maps the content files of a site to their output paths and URLs.
+// Files are added first, then Resolve assigns every file a unique route, so
+// the pipeline, explorer and wikilink resolver all agree on where pages live.
+type Routes struct {
+	style    string
+	slugger  Slugger
+	pending  []routeCandidate
+	routes   map[string]*Route
+	byOutput map[string]*Route
+}
+
+type routeCandidate struct {
+	source string
+	dir    string
+	slug   string
+	ext    string
+	page   bool
+}
+
+func NewRoutes(style string, slugger Slugger) *Routes {
+	return &Routes{
+		style:    style,
+		slugger:  slugger,
+		routes:   make(map[string]*Route),
+		byOutput: make(map[string]*Route),
+	}
+}
+
+func (r *Routes) Style() string {
+	return r.style
+}
+
+// Slugger returns the slug rules used for the routes, which headings and
+// link fragments follow too.
+func (r *Routes) Slugger() Slugger {
+	return r.slugger
+}
+
+// Add registers a content file by its path relative to the content directory.
+// Pages are rendered to HTML, other files are copied as they are.
+func (r *Routes) Add(relPath string, page bool) {
+	slug := r.slugger.PathToSlug(relPath)
+	if slug == "" {
+		slug = "untitled"
+	}
+
+	r.pending = append(r.pending, routeCandidate{
+		source: relPath,
+		dir:    r.slugger.SlugifyPath(filepath.Dir(relPath)),
+		slug:   slug,
+		ext:    filepath.Ext(relPath),
+		page:   page,
+	})
+}
+
+// Resolve assigns a route to every added file. When several files map to the
+// same output path or URL, the first in path order keeps it and the others
+// get a numbered suffix (notes-2, notes-3, ...). The collisions are returned
+// so callers can report them.
+func (r *Routes) Resolve() []Collision {
+	candidates := r.pending
+	r.pending = nil
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].source < candidates[j].source
+	})
+
+	claims := make(map[string][]string)
+	for _, c := range candidates {
+		for _, key := range r.keys(c.route(c.slug, r.style)) {
+			claims[key] = append(claims[key], c.source)
+		}
+	}
+
+	var losers []routeCandidate
+	lostKeys := make(map[string]bool)
+	var lostOrder []string
+	for _, c := range candidates {
+		route := c.route(c.slug, r.style)
+		lost := false
+		for _, key := range r.keys(route) {
+			if claims[key][0] != c.source {
+				if !lostKeys[key] {
+					lostKeys[key] = true
+					lostOrder = append(lostOrder, key)
+				}
+				lost = true
+				break
+			}
+		}
+		if lost {
+			losers = append(losers, c)
+			continue
+		}
+		r.add(route)
+	}
+
+	for _, c := range losers {
+		for n := 2; ; n++ {
+			route := c.route(fmt.Sprintf("%s-%d", c.slug, n), r.style)
+			keys := r.keys(route)
+			if claims[keys[0]] != nil || claims[keys[1]] != nil {
+				continue
+			}
+			for _, key := range keys {
+				claims[key] = []string{c.source}
+			}
+			r.add(route)
+			break
+		}
+	}
+
+	collisions := make([]Collision, 0, len(lostOrder))
+	for _, key := range lostOrder {
+		collisions = append(collisions, Collision{
+			Path:    strings.SplitN(key, ":", 2)[1],
+			Sources: claims[key],
+		})
+	}
+	return collisions
+}
+
+func (r *Routes) add(route *Route) {
+	r.routes[route.Source] = route
+	r.byOutput[filepath.ToSlash(route.Output)] = route
+}
+
+// keys returns the claims a route makes: its output path, compared case
+// insensitively as on most desktop file systems, and its URL.
+func (r *Routes) keys(route *Route) []string {
+	return []string{
+		"output:" + strings.ToLower(filepath.ToSlash(route.Output)),
+		"url:" + route.URL,
+	}
+}
+
+func (c routeCandidate) route(slug, style string) *Route {
+	route := &Route{Source: c.source, Page: c.page}
+	if c.page {
+		route.Output = pageOutputPath(c.dir, slug, style)
+		route.URL = pageURL(c.dir, slug, style)
+	} else {
+		route.Output = staticOutputPath(c.dir, slug, c.ext)
+		route.URL = "/" + filepath.ToSlash(route.Output)
+	}
+	return route
+}
+
+// Get returns the route of the content file at relPath, if it was added.
+func (r *Routes) Get(relPath string) (*Route, bool) {
+	route, ok := r.routes[relPath]
+	return route, ok
+}
+
+// ByOutput returns the route of the file written to output, a slash-separated
+// path relative to the output directory.
+func (r *Routes) ByOutput(output string) (*Route, bool) {
+	route, ok := r.byOutput[output]
+	return route, ok
+}
+
+// URL returns the site URL of the content file at relPath, if it was added.
+func (r *Routes) URL(relPath string) (string, bool) {
+	route, ok := r.routes[relPath]
+	if !ok {
+		return "", false
+	}
+	return route.URL, true
+}
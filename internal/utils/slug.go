@@ -1,23 +1,80 @@
 package utils
 
 import (
+	"net/url"
+	"path"
 	"path/filepath"
 	"regexp"
 	"strings"
+	"unicode"
 )
 
 var reNonAlnum = regexp.MustCompile(`[^a-z0-9]+`)
 
-func PathToSlug(path string) string {
+// Slug modes, selected by the slugMode config option.
+const (
+	// SlugModeASCII keeps only a-z and 0-9.
+	SlugModeASCII = "ascii"
+	// SlugModeUnicode keeps letters and digits of every script. Links
+	// percent-encode them.
+	SlugModeUnicode = "unicode"
+	// SlugModeTransliterate spells Latin, Greek, Cyrillic and kana letters
+	// with a-z and keeps the letters it has no spelling for, as in
+	// SlugModeUnicode.
+	SlugModeTransliterate = "transliterate"
+)
+
+// Slugger turns file names, folder names and heading text into slugs.
+// The zero value uses SlugModeASCII.
+type Slugger struct {
+	mode string
+}
+
+func NewSlugger(mode string) Slugger {
+	return Slugger{mode: mode}
+}
+
+func (s Slugger) Slugify(str string) string {
+	switch s.mode {
+	case SlugModeUnicode:
+		return slugifyUnicode(str)
+	case SlugModeTransliterate:
+		return slugifyUnicode(Transliterate(str))
+	default:
+		str = strings.ToLower(str)
+		str = reNonAlnum.ReplaceAllString(str, "-")
+		return strings.Trim(str, "-")
+	}
+}
+
+// slugifyUnicode lowercases str and replaces every run of characters that
+// are not letters, digits or combining marks with a single hyphen.
+func slugifyUnicode(str string) string {
+	var b strings.Builder
+	pendingHyphen := false
+	for _, r := range strings.ToLower(str) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.Is(unicode.Mn, r) {
+			if pendingHyphen && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			pendingHyphen = false
+			b.WriteRune(r)
+			continue
+		}
+		pendingHyphen = true
+	}
+	return b.String()
+}
+
+// PathToSlug returns the slug of the file name at path, without extension.
+func (s Slugger) PathToSlug(path string) string {
 	base := filepath.Base(path)
-	name := strings.TrimSuffix(base, filepath.Ext(base))
-	name = strings.ToLower(name)
-	name = reNonAlnum.ReplaceAllString(name, "-")
-	name = strings.Trim(name, "-")
-	return name
+	return s.Slugify(strings.TrimSuffix(base, filepath.Ext(base)))
 }
 
-func SlugifyPath(path string) string {
+// SlugifyPath slugifies every folder of path, dropping those whose slug is
+// empty.
+func (s Slugger) SlugifyPath(path string) string {
 	if path == "" || path == "." {
 		return ""
 	}
@@ -29,10 +86,7 @@ func SlugifyPath(path string) string {
 		if part == "" || part == "." {
 			continue
 		}
-		sluggedPart := strings.ToLower(part)
-		sluggedPart = reNonAlnum.ReplaceAllString(sluggedPart, "-")
-		sluggedPart = strings.Trim(sluggedPart, "-")
-		if sluggedPart != "" {
+		if sluggedPart := s.Slugify(part); sluggedPart != "" {
 			slugged = append(slugged, sluggedPart)
 		}
 	}
@@ -40,8 +94,82 @@ func SlugifyPath(path string) string {
 	return filepath.Join(slugged...)
 }
 
+// PageURL returns the site URL of the page generated from the content file at
+// relPath. Folder index files map to the folder itself.
+func (s Slugger) PageURL(relPath, style string) string {
+	return pageURL(s.SlugifyPath(filepath.Dir(relPath)), s.PathToSlug(relPath), style)
+}
+
+// StaticOutputPath returns the path, relative to the output directory, a
+// static file at relPath is copied to.
+func (s Slugger) StaticOutputPath(relPath string) string {
+	return staticOutputPath(s.SlugifyPath(filepath.Dir(relPath)), s.PathToSlug(relPath), filepath.Ext(relPath))
+}
+
+func PathToSlug(path string) string {
+	return Slugger{}.PathToSlug(path)
+}
+
+func SlugifyPath(path string) string {
+	return Slugger{}.SlugifyPath(path)
+}
+
 func Slugify(s string) string {
-	s = strings.ToLower(s)
-	s = reNonAlnum.ReplaceAllString(s, "-")
-	return strings.Trim(s, "-")
+	return Slugger{}.Slugify(s)
+}
+
+// StaticOutputPath returns the path, relative to the output directory, a
+// static file at relPath is copied to, using ASCII slugs.
+func StaticOutputPath(relPath string) string {
+	return Slugger{}.StaticOutputPath(relPath)
+}
+
+// EscapeURLPath percent-encodes a site URL for use in an href.
+func EscapeURLPath(urlPath string) string {
+	return (&url.URL{Path: urlPath}).EscapedPath()
+}
+
+// URL styles for generated pages, selected by the urlStyle config option.
+const (
+	// URLStyleClean writes a/b.html and links to /a/b, which relies on the
+	// host resolving extensionless URLs.
+	URLStyleClean = "clean"
+	// URLStylePretty writes a/b/index.html and links to /a/b/.
+	URLStylePretty = "pretty"
+	// URLStyleHTML writes a/b.html and links to /a/b.html.
+	URLStyleHTML = "html"
+)
+
+func pageURL(sluggedDir, slug, style string) string {
+	if slug == "index" {
+		slug = ""
+	}
+
+	urlPath := path.Join(filepath.ToSlash(sluggedDir), slug)
+	if urlPath == "" {
+		return "/"
+	}
+
+	switch style {
+	case URLStylePretty:
+		return "/" + urlPath + "/"
+	case URLStyleHTML:
+		if slug == "" {
+			return "/" + urlPath + "/index.html"
+		}
+		return "/" + urlPath + ".html"
+	default:
+		return "/" + urlPath
+	}
+}
+
+func pageOutputPath(sluggedDir, slug, style string) string {
+	if style == URLStylePretty && slug != "index" {
+		return filepath.Join(sluggedDir, slug, "index.html")
+	}
+	return filepath.Join(sluggedDir, slug+".html")
+}
+
+func staticOutputPath(sluggedDir, slug, ext string) string {
+	return filepath.Join(sluggedDir, slug+strings.ToLower(ext))
 }
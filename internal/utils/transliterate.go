@@ -0,0 +1,222 @@
+package utils
+
+import (
+	"strings"
+	"unicode"
+)
+
+// transliterations spells single characters with ASCII letters. It covers
+// the Latin-1 and Latin Extended-A letters used by European languages and
+// Indonesian loanwords, Greek, and Russian, Ukrainian and Belarusian
+// Cyrillic. Kana are handled separately by transliterateKana.
+var transliterations = buildTransliterations(map[string]string{
+	"ÀÁÂÃÄÅĀĂĄàáâãäåāăą": "a",
+	"Ææ":                 "ae",
+	"ÇĆĈĊČçćĉċč":         "c",
+	"ĎĐďđÐð":             "d",
+	"ÈÉÊËĒĔĖĘĚèéêëēĕėęě": "e",
+	"ĜĞĠĢĝğġģ":           "g",
+	"ĤĦĥħ":               "h",
+	"ÌÍÎÏĨĪĬĮİìíîïĩīĭįı": "i",
+	"Ĳĳ":                 "ij",
+	"Ĵĵ":                 "j",
+	"Ķķĸ":                "k",
+	"ĹĻĽĿŁĺļľŀł":         "l",
+	"ÑŃŅŇŊñńņňŉŋ":        "n",
+	"ÒÓÔÕÖØŌŎŐòóôõöøōŏő": "o",
+	"Œœ":                 "oe",
+	"ŔŖŘŕŗř":             "r",
+	"ŚŜŞŠśŝşšſ":          "s",
+	"ß":                  "ss",
+	"ŢŤŦţťŧ":             "t",
+	"Þþ":                 "th",
+	"ÙÚÛÜŨŪŬŮŰŲùúûüũūŭůűų": "u",
+	"Ŵŵ":     "w",
+	"ÝŸŶýÿŷ": "y",
+	"ŹŻŽźżž": "z",
+
+	"Αα":    "a",
+	"Ββ":    "v",
+	"Γγ":    "g",
+	"Δδ":    "d",
+	"Εε":    "e",
+	"Ζζ":    "z",
+	"Ηη":    "i",
+	"Θθ":    "th",
+	"Ιι":    "i",
+	"Κκ":    "k",
+	"Λλ":    "l",
+	"Μμ":    "m",
+	"Νν":    "n",
+	"Ξξ":    "x",
+	"Οο":    "o",
+	"Ππ":    "p",
+	"Ρρ":    "r",
+	"Σσς":   "s",
+	"Ττ":    "t",
+	"Υυ":    "y",
+	"Φφ":    "f",
+	"Χχ":    "ch",
+	"Ψψ":    "ps",
+	"Ωω":    "o",
+	"Άά":    "a",
+	"Έέ":    "e",
+	"Ήή":    "i",
+	"ΊίΐΪϊ": "i",
+	"Όό":    "o",
+	"ΎύΰΫϋ": "y",
+	"Ώώ":    "o",
+
+	"Аа":   "a",
+	"Бб":   "b",
+	"Вв":   "v",
+	"Гг":   "g",
+	"Ґґ":   "g",
+	"Дд":   "d",
+	"Ее":   "e",
+	"Ёё":   "yo",
+	"Єє":   "ye",
+	"Жж":   "zh",
+	"Зз":   "z",
+	"Ии":   "i",
+	"ІіЇї": "i",
+	"Йй":   "y",
+	"Кк":   "k",
+	"Лл":   "l",
+	"Мм":   "m",
+	"Нн":   "n",
+	"Оо":   "o",
+	"Пп":   "p",
+	"Рр":   "r",
+	"Сс":   "s",
+	"Тт":   "t",
+	"Уу":   "u",
+	"Ўў":   "u",
+	"Фф":   "f",
+	"Хх":   "kh",
+	"Цц":   "ts",
+	"Чч":   "ch",
+	"Шш":   "sh",
+	"Щщ":   "shch",
+	"ЪъЬь": "",
+	"Ыы":   "y",
+	"Ээ":   "e",
+	"Юю":   "yu",
+	"Яя":   "ya",
+})
+
+func buildTransliterations(groups map[string]string) map[rune]string {
+	table := make(map[rune]string)
+	for chars, ascii := range groups {
+		for _, r := range chars {
+			table[r] = ascii
+		}
+	}
+	return table
+}
+
+// kana spells the hiragana syllables in Hepburn romanization. Katakana are
+// looked up by their hiragana counterpart.
+var kana = map[rune]string{
+	'あ': "a", 'い': "i", 'う': "u", 'え': "e", 'お': "o",
+	'か': "ka", 'き': "ki", 'く': "ku", 'け': "ke", 'こ': "ko",
+	'が': "ga", 'ぎ': "gi", 'ぐ': "gu", 'げ': "ge", 'ご': "go",
+	'さ': "sa", 'し': "shi", 'す': "su", 'せ': "se", 'そ': "so",
+	'ざ': "za", 'じ': "ji", 'ず': "zu", 'ぜ': "ze", 'ぞ': "zo",
+	'た': "ta", 'ち': "chi", 'つ': "tsu", 'て': "te", 'と': "to",
+	'だ': "da", 'ぢ': "ji", 'づ': "zu", 'で': "de", 'ど': "do",
+	'な': "na", 'に': "ni", 'ぬ': "nu", 'ね': "ne", 'の': "no",
+	'は': "ha", 'ひ': "hi", 'ふ': "fu", 'へ': "he", 'ほ': "ho",
+	'ば': "ba", 'び': "bi", 'ぶ': "bu", 'べ': "be", 'ぼ': "bo",
+	'ぱ': "pa", 'ぴ': "pi", 'ぷ': "pu", 'ぺ': "pe", 'ぽ': "po",
+	'ま': "ma", 'み': "mi", 'む': "mu", 'め': "me", 'も': "mo",
+	'や': "ya", 'ゆ': "yu", 'よ': "yo",
+	'ら': "ra", 'り': "ri", 'る': "ru", 'れ': "re", 'ろ': "ro",
+	'わ': "wa", 'ゐ': "i", 'ゑ': "e", 'を': "o", 'ん': "n",
+	'ぁ': "a", 'ぃ': "i", 'ぅ': "u", 'ぇ': "e", 'ぉ': "o",
+	'ゔ': "vu",
+}
+
+// smallKana combine with the preceding syllable: き+ゃ is kya, し+ゃ is sha.
+var smallKana = map[rune]string{'ゃ': "a", 'ゅ': "u", 'ょ': "o"}
+
+const katakanaOffset = 'ア' - 'あ'
+
+// toHiragana maps a katakana letter to its hiragana counterpart.
+func toHiragana(r rune) rune {
+	if r >= 'ァ' && r <= 'ヶ' {
+		return r - katakanaOffset
+	}
+	return r
+}
+
+// Transliterate spells the Latin, Greek, Cyrillic and kana letters of s with
+// ASCII letters. Other characters are returned unchanged.
+func Transliterate(s string) string {
+	var b strings.Builder
+	runes := []rune(s)
+
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+
+		if ascii, ok := transliterations[r]; ok {
+			if len(ascii) > 0 && unicode.IsUpper(r) {
+				ascii = strings.ToUpper(ascii[:1]) + ascii[1:]
+			}
+			b.WriteString(ascii)
+			continue
+		}
+
+		if n := transliterateKana(&b, runes, i); n > 0 {
+			i += n - 1
+			continue
+		}
+
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
+
+// transliterateKana writes the spelling of the kana at runes[i] and returns
+// the number of runes consumed, or 0 if runes[i] is not kana.
+func transliterateKana(b *strings.Builder, runes []rune, i int) int {
+	r := toHiragana(runes[i])
+
+	switch r {
+	case 'っ':
+		// The small tsu doubles the consonant of the next syllable.
+		if i+1 < len(runes) {
+			if next, ok := kana[toHiragana(runes[i+1])]; ok && !strings.ContainsRune("aiueon", rune(next[0])) {
+				b.WriteByte(next[0])
+			}
+		}
+		return 1
+	case 'ー':
+		// The long vowel mark repeats the previous vowel.
+		if s := b.String(); len(s) > 0 && strings.ContainsRune("aiueo", rune(s[len(s)-1])) {
+			b.WriteByte(s[len(s)-1])
+		}
+		return 1
+	}
+
+	syllable, ok := kana[r]
+	if !ok {
+		return 0
+	}
+
+	if i+1 < len(runes) {
+		if vowel, ok := smallKana[toHiragana(runes[i+1])]; ok && len(syllable) >= 2 && strings.HasSuffix(syllable, "i") {
+			stem := strings.TrimSuffix(syllable, "i")
+			if stem == "sh" || stem == "ch" || stem == "j" {
+				b.WriteString(stem + vowel)
+			} else {
+				b.WriteString(stem + "y" + vowel)
+			}
+			return 2
+		}
+	}
+
+	b.WriteString(syllable)
+	return 1
+}
@@ -1,6 +1,6 @@
 // Handle collapsible callouts
-document.addEventListener("DOMContentLoaded", function () {
-  const callouts = document.querySelectorAll(".callout[data-callout-fold]");
+function setupCallouts(root) {
+  const callouts = root.querySelectorAll(".callout[data-callout-fold]");
 
   callouts.forEach((callout) => {
     const title = callout.querySelector(".callout-title");
@@ -15,4 +15,8 @@ document.addEventListener("DOMContentLoaded", function () {
       }
     });
   });
-});
+}
+
+document.addEventListener("DOMContentLoaded", () => setupCallouts(document));
+// Content added later, such as a decrypted page
+document.addEventListener("blaze:content", (event) => setupCallouts(event.target));
@@ -1,5 +1,5 @@
-document.addEventListener("DOMContentLoaded", () => {
-  const codeBlocks = document.querySelectorAll("pre");
+function addCopyButtons(root) {
+  const codeBlocks = root.querySelectorAll("pre");
 
   codeBlocks.forEach((pre) => {
     const container = document.createElement("div");
@@ -17,7 +17,10 @@ document.addEventListener("DOMContentLoaded", () => {
       const code = pre.querySelector("code");
       if (!code) return;
 
-      const text = code.innerText;
+      // Annotation markers and deleted diff lines are not part of the code.
+      const copy = code.cloneNode(true);
+      copy.querySelectorAll(".code-annotation, .line.del").forEach((el) => el.remove());
+      const text = copy.textContent;
 
       navigator.clipboard
         .writeText(text)
@@ -33,4 +36,8 @@ document.addEventListener("DOMContentLoaded", () => {
         });
     });
   });
-});
+}
+
+document.addEventListener("DOMContentLoaded", () => addCopyButtons(document));
+// Content added later, such as a decrypted page
+document.addEventListener("blaze:content", (event) => addCopyButtons(event.target));
@@ -0,0 +1,28 @@
+// Players are only loaded when their facade is clicked.
+const embedAllow =
+  "accelerometer; autoplay; clipboard-write; encrypted-media; gyroscope; picture-in-picture; web-share";
+
+function setupEmbeds(root) {
+  root.querySelectorAll(".embed-facade").forEach((facade) => {
+    facade.addEventListener("click", (event) => {
+      event.preventDefault();
+      const embed = facade.closest(".embed");
+
+      const src = new URL(embed.dataset.embedSrc);
+      src.searchParams.set("autoplay", "1");
+
+      const iframe = document.createElement("iframe");
+      iframe.src = src.toString();
+      iframe.title = embed.dataset.embedTitle || "";
+      iframe.allow = embedAllow;
+      iframe.allowFullscreen = true;
+      iframe.referrerPolicy = "strict-origin-when-cross-origin";
+      facade.replaceWith(iframe);
+      iframe.focus();
+    });
+  });
+}
+
+document.addEventListener("DOMContentLoaded", () => setupEmbeds(document));
+// Content added later, such as a decrypted page
+document.addEventListener("blaze:content", (event) => setupEmbeds(event.target));
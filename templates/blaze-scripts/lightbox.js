@@ -0,0 +1,57 @@
+// Images of figures marked lightbox open at full size over the page.
+function openLightbox(figure) {
+  const img = figure.querySelector("img");
+  if (!img) return;
+
+  const overlay = document.createElement("div");
+  overlay.className = "lightbox-overlay";
+  overlay.setAttribute("role", "dialog");
+  overlay.setAttribute("aria-modal", "true");
+  overlay.tabIndex = -1;
+
+  const full = document.createElement("img");
+  // The original, rather than the variant chosen for the page.
+  full.src = img.src;
+  full.alt = img.alt;
+  overlay.appendChild(full);
+
+  const caption = figure.querySelector("figcaption");
+  if (caption) {
+    const text = document.createElement("p");
+    text.textContent = caption.textContent;
+    overlay.appendChild(text);
+    overlay.setAttribute("aria-label", caption.textContent);
+  }
+
+  const close = () => {
+    overlay.remove();
+    document.removeEventListener("keydown", onKey);
+    img.focus();
+  };
+  const onKey = (event) => {
+    if (event.key === "Escape") close();
+  };
+  overlay.addEventListener("click", close);
+  document.addEventListener("keydown", onKey);
+
+  document.body.appendChild(overlay);
+  overlay.focus();
+}
+
+function setupLightbox(root) {
+  root.querySelectorAll("figure.lightbox img").forEach((img) => {
+    img.tabIndex = 0;
+    img.setAttribute("role", "button");
+    img.addEventListener("click", () => openLightbox(img.closest("figure")));
+    img.addEventListener("keydown", (event) => {
+      if (event.key === "Enter" || event.key === " ") {
+        event.preventDefault();
+        openLightbox(img.closest("figure"));
+      }
+    });
+  });
+}
+
+document.addEventListener("DOMContentLoaded", () => setupLightbox(document));
+// Content added later, such as a decrypted page
+document.addEventListener("blaze:content", (event) => setupLightbox(event.target));
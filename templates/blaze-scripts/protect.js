@@ -0,0 +1,48 @@
+// Decrypt password-protected pages in the browser
+document.addEventListener("DOMContentLoaded", () => {
+  const decode = (value) => Uint8Array.from(atob(value), (c) => c.charCodeAt(0));
+
+  document.querySelectorAll(".protected").forEach((container) => {
+    const form = container.querySelector(".protected-form");
+    const error = container.querySelector(".protected-error");
+
+    form.addEventListener("submit", async (event) => {
+      event.preventDefault();
+      error.hidden = true;
+
+      const password = new TextEncoder().encode(form.elements.password.value);
+
+      try {
+        const baseKey = await crypto.subtle.importKey("raw", password, "PBKDF2", false, [
+          "deriveKey",
+        ]);
+        const key = await crypto.subtle.deriveKey(
+          {
+            name: "PBKDF2",
+            hash: "SHA-256",
+            salt: decode(container.dataset.salt),
+            iterations: Number(container.dataset.iterations),
+          },
+          baseKey,
+          { name: "AES-GCM", length: 256 },
+          false,
+          ["decrypt"]
+        );
+        const plaintext = await crypto.subtle.decrypt(
+          { name: "AES-GCM", iv: decode(container.dataset.iv) },
+          key,
+          decode(container.dataset.ciphertext)
+        );
+
+        const content = document.createElement("div");
+        content.innerHTML = new TextDecoder().decode(plaintext);
+        container.replaceWith(content);
+
+        // Let the other scripts set up the decrypted content.
+        content.dispatchEvent(new CustomEvent("blaze:content", { bubbles: true }));
+      } catch (err) {
+        error.hidden = false;
+      }
+    });
+  });
+});
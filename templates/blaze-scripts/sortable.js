@@ -0,0 +1,55 @@
+// Tables marked sortable are sorted by a column when its header is clicked,
+// in ascending then descending order. Numbers sort by value.
+const collator = new Intl.Collator(undefined, { numeric: true, sensitivity: "base" });
+
+function cellValue(row, column) {
+  const cell = row.cells[column];
+  return cell ? cell.textContent.trim() : "";
+}
+
+function asNumber(text) {
+  const value = text.replace(/,/g, "").replace(/%$/, "");
+  return value !== "" && !isNaN(value) ? parseFloat(value) : null;
+}
+
+function compare(a, b) {
+  const x = asNumber(a);
+  const y = asNumber(b);
+  if (x !== null && y !== null) return x - y;
+  // Empty cells go last.
+  if (a === "" || b === "") return (a === "") - (b === "");
+  return collator.compare(a, b);
+}
+
+function sortTable(table, th) {
+  const column = th.cellIndex;
+  const ascending = th.getAttribute("aria-sort") !== "ascending";
+  table.querySelectorAll("thead th").forEach((other) => other.removeAttribute("aria-sort"));
+  th.setAttribute("aria-sort", ascending ? "ascending" : "descending");
+
+  const body = table.tBodies[0];
+  const rows = Array.from(body.rows);
+  rows.sort((a, b) => {
+    const order = compare(cellValue(a, column), cellValue(b, column));
+    return ascending ? order : -order;
+  });
+  rows.forEach((row) => body.appendChild(row));
+}
+
+function setupSortable(root) {
+  root.querySelectorAll("table.sortable").forEach((table) => {
+    if (!table.tBodies[0]) return;
+    table.querySelectorAll("thead th").forEach((th) => {
+      const button = document.createElement("button");
+      button.type = "button";
+      button.className = "sort-button";
+      while (th.firstChild) button.appendChild(th.firstChild);
+      th.appendChild(button);
+      button.addEventListener("click", () => sortTable(table, th));
+    });
+  });
+}
+
+document.addEventListener("DOMContentLoaded", () => setupSortable(document));
+// Content added later, such as a decrypted page
+document.addEventListener("blaze:content", (event) => setupSortable(event.target));